@@ -1,22 +1,36 @@
 package main
 
-import fthealth "github.com/Financial-Times/go-fthealth/v1a"
+import (
+	"time"
+
+	fthealth "github.com/Financial-Times/go-fthealth/v1a"
+)
+
+// MeasuredHealth is a health measurement of a service along with how long the check took, whether that's
+// over the slow check threshold, and the FT healthcheck response of the service, nil for other check types
+// or if it couldn't be fetched.
+type MeasuredHealth struct {
+	fthealth.HealthResult
+	Latency     time.Duration
+	Slow        bool
+	Healthcheck *healthcheckResponse
+}
 
 type CachedHealth struct {
-	toWriteToCache  chan fthealth.HealthResult
-	toReadFromCache chan fthealth.HealthResult
+	toWriteToCache  chan MeasuredHealth
+	toReadFromCache chan MeasuredHealth
 	terminate       chan bool
 }
 
 func NewCachedHealth() *CachedHealth {
-	a := make(chan fthealth.HealthResult)
-	b := make(chan fthealth.HealthResult)
+	a := make(chan MeasuredHealth)
+	b := make(chan MeasuredHealth)
 	terminate := make(chan bool)
 	return &CachedHealth{a, b, terminate}
 }
 
 func (c *CachedHealth) maintainLatest() {
-	var aux fthealth.HealthResult
+	var aux MeasuredHealth
 	for {
 		select {
 		case aux = <-c.toWriteToCache:
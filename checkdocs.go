@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+const (
+	defaultTechnicalSummaryTemplate = "The service is not healthy. For detailed information, look at the service healthcheck:  https://{{.Environment}}-up.ft.com{{.Path}}"
+	defaultPanicGuideTemplate       = "https://sites.google.com/a/ft.com/universal-publishing/ops-guides"
+)
+
+// CheckDocTemplates are the templates of the technical summary and the panic guide of the service checks.
+type CheckDocTemplates struct {
+	TechnicalSummary string
+	PanicGuide       string
+}
+
+var defaultCheckDocTemplates = CheckDocTemplates{
+	TechnicalSummary: defaultTechnicalSummaryTemplate,
+	PanicGuide:       defaultPanicGuideTemplate,
+}
+
+// checkDocFields are the fields available to the technical summary and panic guide templates.
+type checkDocFields struct {
+	Service      string
+	ServiceGroup string
+	Instance     string
+	Environment  string
+	Path         string
+	Categories   []string
+}
+
+// checkDoc is the technical summary and panic guide of the check of a service.
+type checkDoc struct {
+	technicalSummary string
+	panicGuide       string
+}
+
+// CheckDocs renders the technical summary and the panic guide of the service checks, from the templates
+// of the first category of the service overriding them or else from the default ones.
+type CheckDocs struct {
+	technicalSummaryTemplate *template.Template
+	panicGuideTemplate       *template.Template
+}
+
+var defaultCheckDocs, _ = NewCheckDocs(defaultCheckDocTemplates)
+
+var sampleCheckDocService = Service{Name: "service-1", Environment: "local", Path: "/health/service-1/__health", Categories: []string{defaultCategoryName}}
+
+func NewCheckDocs(templates CheckDocTemplates) (*CheckDocs, error) {
+	technicalSummary, err := parseCheckDocTemplate("technical summary", templates.TechnicalSummary)
+	if err != nil {
+		return nil, err
+	}
+	panicGuide, err := parseCheckDocTemplate("panic guide", templates.PanicGuide)
+	if err != nil {
+		return nil, err
+	}
+	return &CheckDocs{technicalSummaryTemplate: technicalSummary, panicGuideTemplate: panicGuide}, nil
+}
+
+// parseCheckDocTemplate parses a technical summary or panic guide template, and renders it for a sample service
+// to catch references to unknown fields.
+func parseCheckDocTemplate(name string, text string) (*template.Template, error) {
+	t, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %v template: %v", name, err.Error())
+	}
+	if _, err := renderCheckDoc(t, sampleCheckDocService); err != nil {
+		return nil, fmt.Errorf("Invalid %v template: %v", name, err.Error())
+	}
+	return t, nil
+}
+
+// render is the doc of the check of the service, given the categories overriding the templates.
+func (d *CheckDocs) render(service Service, categories map[string]Category) checkDoc {
+	technicalSummary, panicGuide := d.technicalSummaryTemplate, d.panicGuideTemplate
+	if category, found := overridingCategory(service, categories, func(c Category) bool { return c.TechnicalSummaryTemplate != nil }); found {
+		technicalSummary = category.TechnicalSummaryTemplate
+	}
+	if category, found := overridingCategory(service, categories, func(c Category) bool { return c.PanicGuideTemplate != nil }); found {
+		panicGuide = category.PanicGuideTemplate
+	}
+
+	doc := checkDoc{}
+	var err error
+	if doc.technicalSummary, err = renderCheckDoc(technicalSummary, service); err != nil {
+		warnLogger.Printf("Can't render the technical summary of %v: %v. Using the default one.", service.Name, err.Error())
+		doc.technicalSummary, _ = renderCheckDoc(d.technicalSummaryTemplate, service)
+	}
+	if doc.panicGuide, err = renderCheckDoc(panicGuide, service); err != nil {
+		warnLogger.Printf("Can't render the panic guide of %v: %v. Using the default one.", service.Name, err.Error())
+		doc.panicGuide, _ = renderCheckDoc(d.panicGuideTemplate, service)
+	}
+	if service.PanicGuide != "" {
+		doc.panicGuide = service.PanicGuide
+	}
+	return doc
+}
+
+// overridingCategory is the first category of the service with an override, the default category coming last
+// as every service is part of it.
+func overridingCategory(service Service, categories map[string]Category, overrides func(Category) bool) (Category, bool) {
+	for _, name := range service.Categories {
+		if category, ok := categories[name]; ok && name != defaultCategoryName && overrides(category) {
+			return category, true
+		}
+	}
+	category, ok := categories[defaultCategoryName]
+	return category, ok && overrides(category)
+}
+
+func renderCheckDoc(t *template.Template, service Service) (string, error) {
+	group, instance := splitServiceInstance(service.Name)
+	var buf bytes.Buffer
+	err := t.Execute(&buf, checkDocFields{
+		Service:      service.Name,
+		ServiceGroup: group,
+		Instance:     instance,
+		Environment:  service.Environment,
+		Path:         service.Path,
+		Categories:   service.Categories,
+	})
+	return strings.TrimSpace(buf.String()), err
+}
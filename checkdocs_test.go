@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultCheckDocs(t *testing.T) {
+	doc := defaultCheckDocs.render(Service{Name: "foo-service-1", Environment: "prod-uk", Path: "/health/foo-service-1/__health"}, nil)
+
+	assert.Equal(t, "The service is not healthy. For detailed information, look at the service healthcheck:  https://prod-uk-up.ft.com/health/foo-service-1/__health", doc.technicalSummary)
+	assert.Equal(t, defaultPanicGuideTemplate, doc.panicGuide)
+}
+
+func TestCheckDocsFromTemplates(t *testing.T) {
+	docs, err := NewCheckDocs(CheckDocTemplates{
+		TechnicalSummary: "See https://{{.Environment}}-up.ft.com{{.Path}}",
+		PanicGuide:       "https://runbooks.ft.com/{{.ServiceGroup}}",
+	})
+	assert.NoError(t, err)
+
+	doc := docs.render(Service{Name: "foo-service-1", Environment: "prod-us", Path: "/health/foo-service-1/__health"}, nil)
+
+	assert.Equal(t, "See https://prod-us-up.ft.com/health/foo-service-1/__health", doc.technicalSummary)
+	assert.Equal(t, "https://runbooks.ft.com/foo-service", doc.panicGuide)
+}
+
+func TestCheckDocsOverriddenByCategory(t *testing.T) {
+	docs, err := NewCheckDocs(CheckDocTemplates{TechnicalSummary: "Cluster summary", PanicGuide: "https://runbooks.ft.com/cluster"})
+	assert.NoError(t, err)
+	categories := map[string]Category{
+		defaultCategoryName: {Name: defaultCategoryName, PanicGuideTemplate: template.Must(template.New("").Parse("https://runbooks.ft.com/default"))},
+		"read":              {Name: "read"},
+		"publish":           {Name: "publish", TechnicalSummaryTemplate: template.Must(template.New("").Parse("Publishing of {{.Service}} is broken"))},
+	}
+
+	doc := docs.render(Service{Name: "foo", Categories: []string{defaultCategoryName, "read", "publish"}}, categories)
+
+	assert.Equal(t, "Publishing of foo is broken", doc.technicalSummary)
+	assert.Equal(t, "https://runbooks.ft.com/default", doc.panicGuide)
+
+	doc = docs.render(Service{Name: "foo", Categories: []string{defaultCategoryName, "read"}, PanicGuide: "https://runbooks.ft.com/foo"}, categories)
+
+	assert.Equal(t, "Cluster summary", doc.technicalSummary)
+	assert.Equal(t, "https://runbooks.ft.com/foo", doc.panicGuide, "the panic guide of the service overrides the templates")
+}
+
+func TestCheckDocsFallBackToDefaultTemplate(t *testing.T) {
+	docs, err := NewCheckDocs(CheckDocTemplates{TechnicalSummary: "Cluster summary", PanicGuide: "https://runbooks.ft.com/cluster"})
+	assert.NoError(t, err)
+	categories := map[string]Category{
+		"read": {Name: "read", PanicGuideTemplate: template.Must(template.New("").Parse("https://runbooks.ft.com/{{index .Categories 5}}"))},
+	}
+
+	doc := docs.render(Service{Name: "foo", Categories: []string{defaultCategoryName, "read"}}, categories)
+
+	assert.Equal(t, "https://runbooks.ft.com/cluster", doc.panicGuide)
+}
+
+func TestInvalidCheckDocTemplates(t *testing.T) {
+	_, err := NewCheckDocs(CheckDocTemplates{TechnicalSummary: "{{.Environment", PanicGuide: defaultPanicGuideTemplate})
+	assert.Error(t, err)
+
+	_, err = NewCheckDocs(CheckDocTemplates{TechnicalSummary: defaultTechnicalSummaryTemplate, PanicGuide: "https://runbooks.ft.com/{{.Team}}"})
+	assert.Error(t, err, "the templates can't refer to unknown fields")
+}
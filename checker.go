@@ -7,7 +7,9 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"regexp"
 	"strings"
+	"time"
 
 	fthealth "github.com/Financial-Times/go-fthealth/v1a"
 )
@@ -32,8 +34,9 @@ type check struct {
 
 type HealthChecker interface {
 	Check(Service) (string, error)
+	// CheckDetailed checks the service like Check, also returning the FT healthcheck response it parsed, if any
+	CheckDetailed(Service) (string, *healthcheckResponse, error)
 	IsHighSeverity(string) bool
-	FetchHealthcheck(Service) (*healthcheckResponse, error)
 }
 
 type HTTPHealthChecker struct {
@@ -54,8 +57,14 @@ func (c *HTTPHealthChecker) FetchHealthcheck(service Service) (*healthcheckRespo
 	}
 
 	req.Host = service.Name
+	if service.HostHeader != "" {
+		req.Host = service.HostHeader
+	}
+	for name, value := range service.Headers {
+		req.Header.Set(name, value)
+	}
 
-	resp, err := c.client.Do(req)
+	resp, err := clientFor(c.client, service).Do(req)
 	if err != nil {
 		return health, errors.New("Error performing healthcheck: " + err.Error())
 	}
@@ -65,8 +74,15 @@ func (c *HTTPHealthChecker) FetchHealthcheck(service Service) (*healthcheckRespo
 		resp.Body.Close()
 	}()
 
-	if resp.StatusCode != 200 {
-		return health, fmt.Errorf("Healthcheck endpoint returned non-200 status (%v)", resp.Status)
+	if !isExpectedStatus(service, resp.StatusCode) {
+		if len(service.ExpectedStatuses) == 0 {
+			return health, fmt.Errorf("Healthcheck endpoint returned non-200 status (%v)", resp.Status)
+		}
+		return health, fmt.Errorf("Healthcheck endpoint returned unexpected status (%v), expecting one of %v", resp.Status, service.ExpectedStatuses)
+	}
+
+	if resp.StatusCode == http.StatusNoContent {
+		return health, nil
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
@@ -79,54 +95,207 @@ func (c *HTTPHealthChecker) FetchHealthcheck(service Service) (*healthcheckRespo
 	}
 	return health, nil
 }
+
+// maxServiceTimeout is the longest timeout of a service, the response header timeout of the transport
+// shared by the HTTP checks cutting the longer ones short.
+const maxServiceTimeout = 10 * time.Second
+
+// clientFor is the client to check the service with, with its own timeout if any.
+func clientFor(client *http.Client, service Service) *http.Client {
+	if service.Timeout <= 0 {
+		return client
+	}
+	withTimeout := *client
+	withTimeout.Timeout = service.Timeout
+	return &withTimeout
+}
+
+func isExpectedStatus(service Service, status int) bool {
+	if len(service.ExpectedStatuses) == 0 {
+		return status == http.StatusOK
+	}
+	for _, expected := range service.ExpectedStatuses {
+		if status == expected {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *HTTPHealthChecker) Check(service Service) (string, error) {
+	output, _, err := c.CheckDetailed(service)
+	return output, err
+}
+
+// CheckDetailed checks the service like Check, also returning its healthcheck response, nil if it couldn't be
+// fetched or parsed.
+func (c *HTTPHealthChecker) CheckDetailed(service Service) (string, *healthcheckResponse, error) {
 	health, err := c.FetchHealthcheck(service)
 	if (err != nil) {
-		return "", err
+		return "", nil, err
 	}
 
 	failed := []string{}
+	var severity uint8
 	for _, check := range health.Checks {
 		if check.OK != true {
 			failed = append(failed, check.Name)
+			if check.Severity != 0 && (severity == 0 || check.Severity < severity) {
+				severity = check.Severity
+			}
 		}
 	}
 
 	if count := len(failed); count > 0 {
-		return "", fmt.Errorf("%d healthchecks failing (%v)", count, strings.Join(failed, ", "))
+		message := fmt.Sprintf("%d healthchecks failing (%v)", count, strings.Join(failed, ", "))
+		if serviceSeverity(service, c) == 1 {
+			severity = 1
+		}
+		if severity == 0 {
+			return "", health, errors.New(message)
+		}
+		return "", health, &severityError{severity, message}
 	}
 
-	return "", nil
+	return "", health, nil
 }
 
-func NewServiceHealthCheck(service Service, checker HealthChecker) fthealth.Check {
-	//horrible hack...but we really need this for the soft go-live
-	var severity uint8 = 2
+// failingChecks are the inner checks of the healthcheck which failed.
+func (h *healthcheckResponse) failingChecks() []check {
+	if h == nil {
+		return nil
+	}
+	var failing []check
+	for _, check := range h.Checks {
+		if !check.OK {
+			failing = append(failing, check)
+		}
+	}
+	return failing
+}
 
-	if checker.IsHighSeverity(service.Name) {
-		severity = 1
+const defaultBusinessImpact = "On its own this failure does not have a business impact but it represents a degradation of the cluster health."
+
+// NewServiceHealthCheck is the check of the service, described by its settings in etcd if any and by the
+// technical summary and panic guide rendered for it. Checks reporting the severity of their failures, like
+// FT healthchecks with failing inner checks, override the severity of the service.
+func NewServiceHealthCheck(service Service, checker HealthChecker, doc checkDoc) fthealth.Check {
+	businessImpact := service.BusinessImpact
+	if businessImpact == "" {
+		businessImpact = defaultBusinessImpact
 	}
 	return fthealth.Check{
-		BusinessImpact:   "On its own this failure does not have a business impact but it represents a degradation of the cluster health.",
+		BusinessImpact:   businessImpact,
 		Name:             service.Name,
-		PanicGuide:       "https://sites.google.com/a/ft.com/universal-publishing/ops-guides",
-		Severity:         severity,
-		TechnicalSummary: fmt.Sprintf("The service is not healthy. For detailed information, look at the service healthcheck:  https://%s-up.ft.com%s", service.Environment, service.Path),
+		PanicGuide:       doc.panicGuide,
+		Severity:         serviceSeverity(service, checker),
+		TechnicalSummary: doc.technicalSummary,
 		Checker: func() (string, error) {
 			return checker.Check(service)
 		},
 	}
 }
 
+// serviceSeverity is the severity of the failures of the service: its severity setting if any, otherwise
+// 1 for the severity 1 apps and 2 for the rest.
+func serviceSeverity(service Service, checker HealthChecker) uint8 {
+	if service.Severity != 0 {
+		return service.Severity
+	}
+	if checker.IsHighSeverity(service.Name) {
+		return 1
+	}
+	return 2
+}
+
+// severityError is a check failure reporting its own severity, overriding the one of the check.
+type severityError struct {
+	severity uint8
+	message  string
+}
+
+func (e *severityError) Error() string {
+	return e.message
+}
+
+// slowCheckSeverity is the severity of the healthy checks slower than the threshold, a warning.
+const slowCheckSeverity = 2
+
+// checkMeasure is what a run of a check measures besides its result: how long it took and whether that's
+// too slow, the severity its failure reported if any, and the FT healthcheck response of the service if it
+// has one.
+type checkMeasure struct {
+	latency  time.Duration
+	slow     bool
+	severity uint8
+	health   *healthcheckResponse
+}
+
+// measuredServiceCheck is the check of the service, measured into measure along with the healthcheck
+// response the checker parsed.
+func measuredServiceCheck(service Service, checker HealthChecker, doc checkDoc, measure *checkMeasure) fthealth.Check {
+	check := NewServiceHealthCheck(service, checker, doc)
+	check.Checker = func() (string, error) {
+		output, health, err := checker.CheckDetailed(service)
+		measure.health = health
+		return output, err
+	}
+	return measuredCheck(check, measure)
+}
+
+// measuredCheck records how long every run of the check takes, and the severity its failures report, into measure.
+func measuredCheck(check fthealth.Check, measure *checkMeasure) fthealth.Check {
+	checker := check.Checker
+	check.Checker = func() (string, error) {
+		start := time.Now()
+		output, err := checker()
+		measure.latency = time.Since(start)
+		measure.severity = 0
+		if failure, ok := err.(*severityError); ok {
+			measure.severity = failure.severity
+		}
+		return output, err
+	}
+	return check
+}
+
+// apply overrides the severity of the failed check with the one it reported, if any, and raises a warning for
+// the healthy check slower than the threshold, if any. Slow checks stay healthy, so they don't affect the health
+// of their categories.
+func (m *checkMeasure) apply(result *fthealth.CheckResult, slowThreshold time.Duration) {
+	if !result.Ok && m.severity != 0 {
+		result.Severity = m.severity
+	}
+	m.slow = slowThreshold > 0 && result.Ok && m.latency > slowThreshold
+	if !m.slow {
+		return
+	}
+	output := fmt.Sprintf("SLOW - took %v, over the %v threshold", formatLatency(m.latency), slowThreshold)
+	if result.Output != "" {
+		output += " - " + result.Output
+	}
+	result.Severity = slowCheckSeverity
+	result.Output = output
+}
+
+// IsHighSeverity is whether the service is one of the severity 1 apps, or one of their instances,
+// e.g. foo-service-1 or foo-service@1.service for foo-service, but not foo-service-api.
 func (c *HTTPHealthChecker) IsHighSeverity(serviceName string) bool {
 	for _, appName := range c.sos {
-		if strings.Contains(serviceName, appName) {
+		appName = strings.TrimSpace(appName)
+		if appName == "" || !strings.HasPrefix(serviceName, appName) {
+			continue
+		}
+		suffix := serviceName[len(appName):]
+		if suffix == "" || strings.HasPrefix(suffix, string(serviceInstanceDelimiter)) || instanceSuffixRegex.MatchString(suffix) {
 			return true
 		}
 	}
 	return false
 }
 
+var instanceSuffixRegex = regexp.MustCompile(`^-\d+$`)
+
 func NewCheckFromSingularHealthResult(healthResult fthealth.HealthResult) fthealth.CheckResult {
 	check := healthResult.Checks[0]
 	return fthealth.CheckResult{
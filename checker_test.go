@@ -4,8 +4,12 @@ import (
 	"testing"
 	"github.com/stretchr/testify/assert"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"time"
 	"golang.org/x/net/proxy"
+
+	fthealth "github.com/Financial-Times/go-fthealth/v1a"
 )
 
 var sos = []string{"publish-availability-monitor", "synthetic-list-publish-monitor", "some-other-service"}
@@ -36,3 +40,184 @@ func TestHTTPHealthChecker_IsHighSeverity(t *testing.T) {
 }
 
 
+
+func TestHTTPHealthCheckerServiceSettings(t *testing.T) {
+	var host, token string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+		token = r.Header.Get("X-Token")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"checks": [{"name": "db", "ok": true}]}`))
+	}))
+	defer server.Close()
+	httpClient := getClient()
+	checker := NewHTTPHealthChecker(&httpClient, sos)
+	service := Service{Name: "foo-service-1", Host: strings.TrimPrefix(server.URL, "http://"), Path: "/__health"}
+
+	_, err := checker.Check(service)
+	assert.EqualError(t, err, "Healthcheck endpoint returned non-200 status (202 Accepted)")
+	assert.Equal(t, "foo-service-1", host)
+
+	service.ExpectedStatuses = []int{200, 202}
+	service.HostHeader = "foo.example.com"
+	service.Headers = map[string]string{"X-Token": "secret"}
+	_, err = checker.Check(service)
+	assert.NoError(t, err)
+	assert.Equal(t, "foo.example.com", host)
+	assert.Equal(t, "secret", token)
+}
+
+func TestHTTPHealthCheckerServiceTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte(`{"checks": []}`))
+	}))
+	defer server.Close()
+	httpClient := getClient()
+	checker := NewHTTPHealthChecker(&httpClient, sos)
+	service := Service{Name: "foo-service-1", Host: strings.TrimPrefix(server.URL, "http://"), Path: "/__health", Timeout: 50 * time.Millisecond}
+
+	_, err := checker.Check(service)
+	assert.Error(t, err)
+
+	service.Timeout = time.Second
+	_, err = checker.Check(service)
+	assert.NoError(t, err)
+}
+
+func TestHTTPHealthCheckerSeverityOfInnerChecks(t *testing.T) {
+	body := `{"checks": [{"name": "db", "ok": false, "severity": 2}, {"name": "queue", "ok": false, "severity": 1}, {"name": "cache", "ok": true, "severity": 1}]}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+	httpClient := getClient()
+	checker := NewHTTPHealthChecker(&httpClient, sos)
+	service := Service{Name: "foo-service-1", Host: strings.TrimPrefix(server.URL, "http://"), Path: "/__health"}
+
+	_, err := checker.Check(service)
+	assert.EqualError(t, err, "2 healthchecks failing (db, queue)")
+	if assert.IsType(t, &severityError{}, err) {
+		assert.Equal(t, uint8(1), err.(*severityError).severity)
+	}
+
+	body = `{"checks": [{"name": "db", "ok": false, "severity": 3}]}`
+	_, err = checker.Check(service)
+	if assert.IsType(t, &severityError{}, err) {
+		assert.Equal(t, uint8(3), err.(*severityError).severity)
+	}
+
+	service.Name = "publish-availability-monitor-1"
+	_, err = checker.Check(service)
+	if assert.IsType(t, &severityError{}, err) {
+		assert.Equal(t, uint8(1), err.(*severityError).severity, "the severity 1 list overrides the inner checks")
+	}
+
+	body = `{"checks": [{"name": "db", "ok": false}]}`
+	service.Name = "foo-service-1"
+	_, err = checker.Check(service)
+	assert.EqualError(t, err, "1 healthchecks failing (db)")
+	_, reportsSeverity := err.(*severityError)
+	assert.False(t, reportsSeverity, "inner checks without severity keep the one of the service")
+}
+
+func TestMeasuredCheckAppliesReportedSeverity(t *testing.T) {
+	var measure checkMeasure
+	check := measuredCheck(fthealth.Check{Name: "foo", Severity: 2, Checker: func() (string, error) {
+		return "", &severityError{1, "queue failing"}
+	}}, &measure)
+
+	result := fthealth.RunCheck("foo", "", true, check).Checks[0]
+	measure.apply(&result, 0)
+
+	assert.False(t, result.Ok)
+	assert.Equal(t, uint8(1), result.Severity)
+	assert.Equal(t, "queue failing", result.Output)
+}
+
+func TestHTTPHealthChecker_IsHighSeverityMatchesWholeNames(t *testing.T) {
+	checker := NewHTTPHealthChecker(nil, []string{"foo-service", ""})
+
+	assert.True(t, checker.IsHighSeverity("foo-service"))
+	assert.True(t, checker.IsHighSeverity("foo-service-1"))
+	assert.True(t, checker.IsHighSeverity("foo-service@2.service"))
+	assert.False(t, checker.IsHighSeverity("foo-service-api"))
+	assert.False(t, checker.IsHighSeverity("foo-service-api-1"))
+	assert.False(t, checker.IsHighSeverity("bar-service"), "an empty severity 1 app matches no service")
+}
+
+func TestNewServiceHealthCheckFromSettings(t *testing.T) {
+	checker := NewHTTPHealthChecker(nil, []string{"foo-service"})
+
+	doc := checkDoc{technicalSummary: "Look at the healthcheck", panicGuide: "https://runbooks.ft.com/cluster"}
+	defaults := NewServiceHealthCheck(Service{Name: "bar-service-1"}, checker, doc)
+	assert.Equal(t, uint8(2), defaults.Severity)
+	assert.Equal(t, defaultBusinessImpact, defaults.BusinessImpact)
+	assert.Equal(t, "https://runbooks.ft.com/cluster", defaults.PanicGuide)
+	assert.Equal(t, "Look at the healthcheck", defaults.TechnicalSummary)
+	assert.Equal(t, uint8(1), NewServiceHealthCheck(Service{Name: "foo-service-1"}, checker, doc).Severity)
+
+	configured := NewServiceHealthCheck(Service{Name: "foo-service-1", Severity: 3, BusinessImpact: "No new articles"}, checker, doc)
+	assert.Equal(t, uint8(3), configured.Severity, "the severity setting overrides the severity 1 apps")
+	assert.Equal(t, "No new articles", configured.BusinessImpact)
+}
+
+func TestHTTPHealthCheckerKeepsHealthcheckResponse(t *testing.T) {
+	body := `{"systemCode": "up-foo", "checks": [{"name": "db", "ok": false, "severity": 2, "checkOutput": "connection refused"}, {"name": "cache", "ok": true}]}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+	httpClient := getClient()
+	checker := NewHTTPHealthChecker(&httpClient, sos)
+	service := Service{Name: "foo-service-1", Host: strings.TrimPrefix(server.URL, "http://"), Path: "/__health"}
+
+	var measure checkMeasure
+	check := measuredServiceCheck(service, checker, checkDoc{}, &measure)
+	result := fthealth.RunCheck(service.Name, "", true, check).Checks[0]
+
+	assert.False(t, result.Ok)
+	if assert.NotNil(t, measure.health) {
+		assert.Equal(t, "up-foo", measure.health.SystemCode)
+		assert.Len(t, measure.health.Checks, 2)
+		failing := measure.health.failingChecks()
+		if assert.Len(t, failing, 1) {
+			assert.Equal(t, "db", failing[0].Name)
+			assert.Equal(t, "connection refused", failing[0].CheckOutput)
+		}
+	}
+
+	server.Close()
+	fthealth.RunCheck(service.Name, "", true, check)
+	assert.Nil(t, measure.health, "no healthcheck response is kept when it can't be fetched")
+}
+
+func TestMeasureMarksSlowChecks(t *testing.T) {
+	fast := checkMeasure{latency: time.Second}
+	result := fthealth.CheckResult{Name: "fast-service", Ok: true, Severity: 1}
+	fast.apply(&result, 3*time.Second)
+	assert.False(t, fast.slow)
+	assert.Equal(t, uint8(1), result.Severity)
+	assert.Empty(t, result.Output)
+
+	slow := checkMeasure{latency: 4200 * time.Millisecond}
+	result = fthealth.CheckResult{Name: "slow-service", Ok: true, Severity: 1}
+	slow.apply(&result, 3*time.Second)
+	assert.True(t, slow.slow)
+	assert.True(t, result.Ok, "slow services should stay healthy")
+	assert.Equal(t, uint8(slowCheckSeverity), result.Severity)
+	assert.Equal(t, "SLOW - took 4.2s, over the 3s threshold", result.Output)
+
+	unhealthy := checkMeasure{latency: 5 * time.Second}
+	result = fthealth.CheckResult{Name: "unhealthy-service", Ok: false, Severity: 1, Output: "Timeout"}
+	unhealthy.apply(&result, 3*time.Second)
+	assert.False(t, unhealthy.slow)
+	assert.Equal(t, uint8(1), result.Severity)
+	assert.Equal(t, "Timeout", result.Output)
+
+	disabled := checkMeasure{latency: time.Minute}
+	result = fthealth.CheckResult{Name: "slow-service", Ok: true, Severity: 2}
+	disabled.apply(&result, 0)
+	assert.False(t, disabled.slow)
+	assert.Empty(t, result.Output)
+}
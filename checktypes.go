@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ftJSONCheckType          = "ft-json"
+	plainHTTPStatusCheckType = "plain-http-status"
+	tcpConnectCheckType      = "tcp-connect"
+	grpcHealthCheckType      = "grpc-health"
+	execCheckType            = "exec"
+)
+
+// CheckType is a kind of health check a service can declare with the type key of its etcd directory.
+// Every check type reads its own settings from the other keys of that directory, see Service.Settings.
+type CheckType interface {
+	Check(Service) (string, error)
+}
+
+// CheckTypes dispatches the check of every service to the implementation of its check type, services
+// without a type being checked through their FT JSON healthcheck.
+type CheckTypes struct {
+	ftJSON *HTTPHealthChecker
+	types  map[string]CheckType
+}
+
+func NewCheckTypes(ftJSON *HTTPHealthChecker) *CheckTypes {
+	return &CheckTypes{ftJSON: ftJSON, types: map[string]CheckType{ftJSONCheckType: ftJSON}}
+}
+
+func (c *CheckTypes) register(name string, checkType CheckType) {
+	c.types[name] = checkType
+}
+
+func (c *CheckTypes) Check(service Service) (string, error) {
+	name := service.CheckType
+	if name == "" {
+		name = ftJSONCheckType
+	}
+	checkType, found := c.types[name]
+	if !found {
+		return "", fmt.Errorf("Unknown check type '%v', expecting one of %v", name, strings.Join(c.names(), ", "))
+	}
+	return checkType.Check(service)
+}
+
+func (c *CheckTypes) IsHighSeverity(serviceName string) bool {
+	return c.ftJSON.IsHighSeverity(serviceName)
+}
+
+// CheckDetailed checks the service like Check, also returning its FT healthcheck response, which only
+// services of that type have.
+func (c *CheckTypes) CheckDetailed(service Service) (string, *healthcheckResponse, error) {
+	if service.CheckType != "" && service.CheckType != ftJSONCheckType {
+		output, err := c.Check(service)
+		return output, nil, err
+	}
+	return c.ftJSON.CheckDetailed(service)
+}
+
+func (c *CheckTypes) names() []string {
+	var names []string
+	for name := range c.types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// setting is the value of a setting of the service, or an error naming the etcd key if it is missing.
+func (s Service) setting(name string) (string, error) {
+	value, found := s.Settings[name]
+	if !found || value == "" {
+		return "", fmt.Errorf("Missing setting %v/%v of %v checks", s.ServiceKey, name, s.CheckType)
+	}
+	return value, nil
+}
+
+// settingSeconds is a setting of the service in seconds, or the default if it isn't set.
+func (s Service) settingSeconds(name string, defaultValue time.Duration) (time.Duration, error) {
+	value, found := s.Settings[name]
+	if !found || value == "" {
+		return defaultValue, nil
+	}
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || seconds <= 0 {
+		return 0, fmt.Errorf("Invalid setting %v/%v '%v', expecting a positive number of seconds", s.ServiceKey, name, value)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type MockCheckType struct {
+	checked []Service
+}
+
+func (c *MockCheckType) Check(service Service) (string, error) {
+	c.checked = append(c.checked, service)
+	return "", errors.New("checked by mock")
+}
+
+func TestCheckTypesDispatchesOnType(t *testing.T) {
+	checkTypes := NewCheckTypes(NewHTTPHealthChecker(nil, nil))
+	mockType := &MockCheckType{}
+	checkTypes.register(tcpConnectCheckType, mockType)
+
+	_, err := checkTypes.Check(Service{Name: "db", CheckType: tcpConnectCheckType})
+
+	assert.EqualError(t, err, "checked by mock")
+	assert.Len(t, mockType.checked, 1)
+	assert.Equal(t, "db", mockType.checked[0].Name)
+}
+
+func TestCheckTypesUnknownType(t *testing.T) {
+	checkTypes := NewCheckTypes(NewHTTPHealthChecker(nil, nil))
+
+	_, err := checkTypes.Check(Service{Name: "db", CheckType: "carrier-pigeon"})
+
+	assert.EqualError(t, err, "Unknown check type 'carrier-pigeon', expecting one of ft-json")
+}
+
+func TestCheckTypesCheckDetailedOfOtherType(t *testing.T) {
+	checkTypes := NewCheckTypes(NewHTTPHealthChecker(nil, nil))
+	mockType := &MockCheckType{}
+	checkTypes.register(tcpConnectCheckType, mockType)
+
+	_, health, err := checkTypes.CheckDetailed(Service{Name: "db", CheckType: tcpConnectCheckType})
+
+	assert.EqualError(t, err, "checked by mock")
+	assert.Len(t, mockType.checked, 1)
+	assert.Nil(t, health, "only ft-json services have a healthcheck response")
+}
+
+func TestServiceSettings(t *testing.T) {
+	service := Service{ServiceKey: "/ft/healthcheck/db", CheckType: tcpConnectCheckType, Settings: map[string]string{"address": "db:5432", "timeout_seconds": "1.5", "bad_seconds": "soon"}}
+
+	address, err := service.setting("address")
+	assert.NoError(t, err)
+	assert.Equal(t, "db:5432", address)
+	_, err = service.setting("port")
+	assert.EqualError(t, err, "Missing setting /ft/healthcheck/db/port of tcp-connect checks")
+
+	timeout, err := service.settingSeconds("timeout_seconds", time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, 1500*time.Millisecond, timeout)
+	timeout, err = service.settingSeconds("other_seconds", time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, timeout)
+	_, err = service.settingSeconds("bad_seconds", time.Second)
+	assert.Error(t, err)
+}
@@ -8,6 +8,7 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	"fmt"
 
@@ -23,6 +24,7 @@ var defaultCategories = []string{"default"}
 type Controller struct {
 	registry    ServiceRegistry
 	environment *string
+	selfChecks  *AggregatorHealth
 }
 
 type ServiceHealthCheck struct {
@@ -33,6 +35,12 @@ type ServiceHealthCheck struct {
 	IsAcked     bool
 	LastUpdated string
 	Ack         string
+	IsSelfCheck bool
+	Latency     string
+	IsSlow      bool
+	Team        string
+	// inner checks of the FT healthcheck of the service, from its latest check
+	InnerChecks []check
 }
 
 type AggregateHealthCheck struct {
@@ -43,6 +51,21 @@ type AggregateHealthCheck struct {
 	HealthChecks    []ServiceHealthCheck
 	ServicesAck     Acknowledge
 	ClusterAck      string
+	Aggregator      string
+}
+
+// measuredHealthResult is a health result along with how long every check took and who owns the service,
+// as served in JSON.
+type measuredHealthResult struct {
+	fthealth.HealthResult
+	Checks []measuredCheckResult `json:"checks"`
+}
+
+type measuredCheckResult struct {
+	fthealth.CheckResult
+	LatencySeconds float64 `json:"latencySeconds,omitempty"`
+	Team           string  `json:"team,omitempty"`
+	SystemCode     string  `json:"systemCode,omitempty"`
 }
 
 type Acknowledge struct {
@@ -51,7 +74,7 @@ type Acknowledge struct {
 }
 
 func NewController(registry ServiceRegistry, environment *string) *Controller {
-	return &Controller{registry, environment}
+	return &Controller{registry: registry, environment: environment}
 }
 
 func (c Controller) buildHealthResultFor(categories []string, useCache bool) (fthealth.HealthResult, []string, []string) {
@@ -75,12 +98,7 @@ func (c Controller) buildHealthResultFor(categories []string, useCache bool) (ft
 	}
 
 	for category, results := range categorisedResults {
-		var catOk bool
-		if c.registry.areResilient([]string{category}) {
-			catOk, _ = c.computeResilientHealthResult(results)
-		} else {
-			catOk, _ = c.computeNonResilientHealthResult(results)
-		}
+		catOk, _ := c.computeCategoryHealthResult(category, results)
 
 		if !catOk {
 			unhealthyServices := []string{}
@@ -107,6 +125,47 @@ func (c Controller) buildHealthResultFor(categories []string, useCache bool) (ft
 	return health, matchingCategories, unhealthyCategories
 }
 
+// addSelfChecks runs the checks of the aggregator itself, if enabled, and adds them to the health result. They
+// are added once the health of the cluster is computed, so they don't affect it.
+func (c Controller) addSelfChecks(health *fthealth.HealthResult) {
+	if c.selfChecks == nil {
+		return
+	}
+	selfResults := fthealth.RunCheck("Aggregator self-checks", "", true, c.selfChecks.checks(c.registry)...).Checks
+	sort.Sort(ByName(selfResults))
+	health.Checks = append(health.Checks, selfResults...)
+}
+
+// cachedMeasurements are the latest measurements of the services, like how long their checks took, from the cache.
+func (c Controller) cachedMeasurements(health fthealth.HealthResult) map[string]MeasuredHealth {
+	measurements := make(map[string]MeasuredHealth)
+	measuredServices := c.registry.measuredServices()
+	for _, check := range health.Checks {
+		if mService, found := measuredServices[check.Name]; found {
+			measurements[check.Name] = <-mService.cachedHealth.toReadFromCache
+		}
+	}
+	return measurements
+}
+
+func formatLatency(latency time.Duration) string {
+	if latency == 0 {
+		return ""
+	}
+	return (latency / time.Millisecond * time.Millisecond).String()
+}
+
+// cachedCategoriesHealth is whether each of the categories is healthy, from the cache. Unlike
+// buildHealthResultFor, it doesn't log the unhealthy services, being called on every scrape of the metrics.
+func (c Controller) cachedCategoriesHealth(categories []string) map[string]bool {
+	_, categorisedResults := c.collectChecksFromCachesFor(categories)
+	healthy := make(map[string]bool)
+	for category, results := range categorisedResults {
+		healthy[category], _ = c.computeCategoryHealthResult(category, results)
+	}
+	return healthy
+}
+
 func (c Controller) collectChecksFromCachesFor(categories []string) ([]fthealth.CheckResult, map[string][]fthealth.CheckResult) {
 	var checkResults []fthealth.CheckResult
 
@@ -124,7 +183,7 @@ func (c Controller) collectChecksFromCachesFor(categories []string) ([]fthealth.
 			continue
 		}
 
-		checkResult := NewCheckFromSingularHealthResult(healthResult)
+		checkResult := NewCheckFromSingularHealthResult(healthResult.HealthResult)
 		checkResult.Ack = healthResult.Checks[0].Ack
 		checkResults = append(checkResults, checkResult)
 		for _, category := range mService.service.Categories {
@@ -147,11 +206,14 @@ func (c Controller) runChecksFor(categories []string) ([]fthealth.CheckResult, m
 	}
 
 	var acks map[string]string = make(map[string]string)
+	measures := make(map[string]*checkMeasure)
 	for _, mService := range c.registry.measuredServices() {
 		if !containsAtLeastOneFrom(categories, mService.service.Categories) {
 			continue
 		}
-		check := NewServiceHealthCheck(*mService.service, c.registry.checker())
+		measure := &checkMeasure{}
+		measures[mService.service.Name] = measure
+		check := measuredServiceCheck(*mService.service, c.registry.checker(), c.registry.checkDoc(*mService.service), measure)
 		checks = append(checks, check)
 		for _, category := range mService.service.Categories {
 			if categoryChecks, exists := categorisedChecks[category]; exists {
@@ -168,9 +230,15 @@ func (c Controller) runChecksFor(categories []string) ([]fthealth.CheckResult, m
 
 	healthChecks := fthealth.RunCheck("Forced check run", "", true, checks...).Checks
 	var result []fthealth.CheckResult
-	for _, ch := range healthChecks {
+	for i, ch := range healthChecks {
+		if measure, found := measures[ch.Name]; found {
+			measure.apply(&ch, c.registry.slowThreshold())
+			healthChecks[i].Severity = ch.Severity
+			healthChecks[i].Output = ch.Output
+		}
 		if ack, found := acks[ch.Name]; found {
 			ch.Ack = ack
+			healthChecks[i].Ack = ack
 		}
 		result = append(result, ch)
 
@@ -182,11 +250,18 @@ func (c Controller) runChecksFor(categories []string) ([]fthealth.CheckResult, m
 			}
 		}
 	}
-	updateCachedAndBufferedHealth(c.registry, healthChecks)
+	updateCachedAndBufferedHealth(c.registry, healthChecks, measures)
 
 	return result, categorisedResults
 }
 
+func (c Controller) computeCategoryHealthResult(category string, results []fthealth.CheckResult) (bool, uint8) {
+	if c.registry.areResilient([]string{category}) {
+		return c.computeResilientHealthResult(results)
+	}
+	return c.computeNonResilientHealthResult(results)
+}
+
 func (c Controller) computeResilientHealthResult(checkResults []fthealth.CheckResult) (bool, uint8) {
 	finalOk := true
 	var finalSeverity uint8 = 2
@@ -235,7 +310,8 @@ func (c Controller) handleHealthcheck(w http.ResponseWriter, r *http.Request) {
 /** 
  * Surfaces an endpoint which returns checks from all services in the cluster
  *
- * Note: doesn't currently avail of caching, so may be a little slow.
+ * Note: the checks come from the healthcheck responses of the latest scheduled checks, kept in the cache, so
+ * services not checked yet or without an FT healthcheck are left out.
  */
 func (c Controller) handleAggHealthcheck(w http.ResponseWriter, r *http.Request) {
 
@@ -249,14 +325,21 @@ func (c Controller) handleAggHealthcheck(w http.ResponseWriter, r *http.Request)
 	response.AggregationSystemCode = "aggregate-healthcheck"
 	response.SchemaVersion = 1
 
-	// Fetch each service's checks and annotate them with the service's system code
+	// Take each service's checks from its cached healthcheck and annotate them with the service's system code
 	for _, mService := range c.registry.measuredServices() {
-		serviceHealthcheck, _ := c.registry.checker().FetchHealthcheck(*mService.service)
+		serviceHealthcheck := (<-mService.cachedHealth.toReadFromCache).Healthcheck
+		if serviceHealthcheck == nil {
+			continue
+		}
 		for _, check := range serviceHealthcheck.Checks {
 			check.CheckSystemCode = serviceHealthcheck.SystemCode
 
-			// Ideally all healthchecks would specify a system code, but for legacy reasons fallback to using the service name
+			// Ideally all healthchecks would specify a system code, but for legacy reasons fallback to the one
+			// configured in etcd, or to using the service name
 			if (serviceHealthcheck.SystemCode == "") {
+				check.CheckSystemCode = mService.service.SystemCode
+			}
+			if (check.CheckSystemCode == "") {
 				check.CheckSystemCode = mService.service.Name
 			}
 
@@ -316,6 +399,8 @@ func (c Controller) catEnabled(validCats []string) bool {
 func (c Controller) jsonHandler(w http.ResponseWriter, r *http.Request) {
 	categories := parseCategories(r.URL)
 	healthResults, validCategories, _ := c.buildHealthResultFor(categories, useCache(r.URL))
+	measurements := c.cachedMeasurements(healthResults)
+	c.addSelfChecks(&healthResults)
 	for i, check := range healthResults.Checks {
 		if check.Ack != "" {
 			healthResults.Checks[i].Output = "ACKED - " + check.Output
@@ -329,13 +414,24 @@ func (c Controller) jsonHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	enc := json.NewEncoder(w)
 
+	healthResults.Description = fmt.Sprintf("%s %s", healthResults.Description, selfMetrics.summary())
 	clusterAckMsg := c.registry.clusterAck()
 	if clusterAckMsg != "" {
 		healthResults.Description = fmt.Sprintf("%s Cluster is acknowledged: %s", healthResults.Description, clusterAckMsg)
 		healthResults.Ok = true
 	}
 
-	err := enc.Encode(healthResults)
+	measuredResults := measuredHealthResult{HealthResult: healthResults}
+	measuredServices := c.registry.measuredServices()
+	for _, check := range healthResults.Checks {
+		result := measuredCheckResult{CheckResult: check, LatencySeconds: measurements[check.Name].Latency.Seconds()}
+		if mService, found := measuredServices[check.Name]; found {
+			result.Team = mService.service.Team
+			result.SystemCode = mService.service.SystemCode
+		}
+		measuredResults.Checks = append(measuredResults.Checks, result)
+	}
+	err := enc.Encode(measuredResults)
 	if err != nil {
 		panic("Couldn't encode health results to ResponseWriter.")
 	}
@@ -350,8 +446,10 @@ func (c Controller) htmlHandler(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("Category does not exist."))
 		return
 	}
+	measurements := c.cachedMeasurements(health)
+	c.addSelfChecks(&health)
 
-	mainTemplate, err := template.ParseFiles("main.html")
+	mainTemplate, err := template.ParseFiles("main.html", "styles.html")
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte("Couldn't open template file for html response"))
@@ -360,6 +458,7 @@ func (c Controller) htmlHandler(w http.ResponseWriter, r *http.Request) {
 
 	var healthChecks []ServiceHealthCheck
 	var aggAck Acknowledge
+	measuredServices := c.registry.measuredServices()
 	for _, check := range health.Checks {
 		hc := ServiceHealthCheck{
 			EtcdName:    check.Name,
@@ -367,6 +466,15 @@ func (c Controller) htmlHandler(w http.ResponseWriter, r *http.Request) {
 			IsHealthy:   check.Ok,
 			IsCritical:  check.Severity == 1,
 			LastUpdated: check.LastUpdated.Format(timeLayout),
+			IsSelfCheck: strings.HasPrefix(check.Name, selfCheckPrefix),
+			Latency:     formatLatency(measurements[check.Name].Latency),
+			IsSlow:      check.Ok && measurements[check.Name].Slow,
+		}
+		if healthcheck := measurements[check.Name].Healthcheck; healthcheck != nil {
+			hc.InnerChecks = healthcheck.Checks
+		}
+		if mService, found := measuredServices[check.Name]; found {
+			hc.Team = mService.service.Team
 		}
 		if check.Ack != "" {
 			hc.IsAcked = true
@@ -388,6 +496,7 @@ func (c Controller) htmlHandler(w http.ResponseWriter, r *http.Request) {
 		HealthChecks:    healthChecks,
 		ServicesAck:     aggAck,
 		ClusterAck:      clusterAck,
+		Aggregator:      selfMetrics.summary(),
 	}
 	if err = mainTemplate.Execute(w, param); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -407,12 +516,18 @@ func formatServiceName(name string) string {
 	return string(nameAsRunes)
 }
 
-func updateCachedAndBufferedHealth(registry ServiceRegistry, healthChecks []fthealth.CheckResult) {
+func updateCachedAndBufferedHealth(registry ServiceRegistry, healthChecks []fthealth.CheckResult, measures map[string]*checkMeasure) {
 	healthResults := splitChecksInHealthResults(healthChecks)
 	measuredServices := registry.measuredServices()
 	for _, healthResult := range healthResults {
 		if mService, found := measuredServices[healthResult.Checks[0].Name]; found {
-			registry.updateCachedAndBufferedHealth(&mService, &healthResult)
+			measuredHealth := &MeasuredHealth{HealthResult: healthResult}
+			if measure, found := measures[healthResult.Checks[0].Name]; found {
+				measuredHealth.Latency = measure.latency
+				measuredHealth.Healthcheck = measure.health
+				measuredHealth.Slow = measure.slow
+			}
+			registry.updateCachedAndBufferedHealth(&mService, measuredHealth)
 		}
 	}
 }
@@ -1,12 +1,13 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"strings"
 	"testing"
+	"time"
 
 	fthealth "github.com/Financial-Times/go-fthealth/v1a"
 	"github.com/stretchr/testify/assert"
@@ -17,45 +18,53 @@ type MockRegistry struct {
 	mock.Mock
 }
 
-func (r MockRegistry) categories() map[string]Category {
+func (r *MockRegistry) categories() map[string]Category {
 	args := r.Called()
 	return args.Get(0).(map[string]Category)
 }
 
-func (r MockRegistry) matchingCategories(categories []string) []string {
+func (r *MockRegistry) matchingCategories(categories []string) []string {
 	args := r.Called(categories)
 	return args.Get(0).([]string)
 }
 
-func (r MockRegistry) areResilient(categories []string) bool {
+func (r *MockRegistry) areResilient(categories []string) bool {
 	args := r.Called(categories)
 	return args.Bool(0)
 }
 
-func (r MockRegistry) measuredServices() map[string]MeasuredService {
+func (r *MockRegistry) measuredServices() map[string]MeasuredService {
 	args := r.Called()
 	return args.Get(0).(map[string]MeasuredService)
 }
 
-func (r MockRegistry) checker() HealthChecker {
+func (r *MockRegistry) checker() HealthChecker {
 	args := r.Called()
 	return args.Get(0).(HealthChecker)
 }
 
-func (r MockRegistry) getServiceAck(serviceKey string) string {
+func (r *MockRegistry) slowThreshold() time.Duration {
+	return 0
+}
+
+func (r *MockRegistry) checkDoc(service Service) checkDoc {
+	return defaultCheckDocs.render(service, nil)
+}
+
+func (r *MockRegistry) getServiceAck(serviceKey string) string {
 	args := r.Called(serviceKey)
 	return args.String(0)
 }
 
-func (r MockRegistry) disableCategoryIfSticky(category string) {
+func (r *MockRegistry) disableCategoryIfSticky(category string) {
 	r.Called(category)
 }
 
-func (r MockRegistry) updateCachedAndBufferedHealth(service *MeasuredService, result *fthealth.HealthResult) {
+func (r *MockRegistry) updateCachedAndBufferedHealth(service *MeasuredService, result *MeasuredHealth) {
 	r.Called(service, result)
 }
 
-func (r MockRegistry) clusterAck() string {
+func (r *MockRegistry) clusterAck() string {
 	return ""
 }
 
@@ -73,9 +82,9 @@ func (c *MockHealthChecker) IsHighSeverity(service string) bool {
 	return args.Bool(0)
 }
 
-func (c *MockHealthChecker) FetchHealthcheck(service Service) (*healthcheckResponse, error) {
-	health := &healthcheckResponse{}
-	return health, nil
+func (c *MockHealthChecker) CheckDetailed(service Service) (string, *healthcheckResponse, error) {
+	output, err := c.Check(service)
+	return output, nil, err
 }
 
 func mockCategories(r *MockRegistry, enabled []string, disabled []string) {
@@ -102,7 +111,7 @@ func mockServices(r *MockRegistry, healthyServicesAndCategories map[string][]str
 	for service, categories := range healthyServicesAndCategories {
 		key := strings.ToLower(strings.Replace(service, " ", "-", -1))
 		s := Service{Name: service, ServiceKey: key, Categories: categories}
-		measuredService := MeasuredService{service: &s}
+		measuredService := NewMeasuredService(&s)
 		measuredServices[service] = measuredService
 		c.On("Check", s).Return("ok", nil)
 	}
@@ -110,7 +119,7 @@ func mockServices(r *MockRegistry, healthyServicesAndCategories map[string][]str
 	for service, categories := range unhealthyServicesAndCategories {
 		key := strings.ToLower(strings.Replace(service, " ", "-", -1))
 		s := Service{Name: service, ServiceKey: key, Categories: categories}
-		measuredService := MeasuredService{service: &s}
+		measuredService := NewMeasuredService(&s)
 		measuredServices[service] = measuredService
 		c.On("Check", s).Return("nok", errors.New("Service "+service+" is unhealthy"))
 	}
@@ -202,7 +211,6 @@ func TestRunChecksForUnhealthy(t *testing.T) {
 }
 
 func TestHandleGtgOk(t *testing.T) {
-	initLogs(os.Stdout, os.Stdout, os.Stderr)
 	any := func(x interface{}) bool { return true }
 
 	registry := new(MockRegistry)
@@ -230,6 +238,34 @@ func TestHandleGtgOk(t *testing.T) {
 	registry.AssertExpectations(t)
 }
 
+func TestJSONHandlerDoesNotCountSelfChecks(t *testing.T) {
+	any := func(x interface{}) bool { return true }
+
+	registry := new(MockRegistry)
+	mockServices(registry, map[string][]string{"Test Service": {"foo"}}, map[string][]string{})
+	mockCategories(registry, []string{"foo"}, []string{})
+	registry.On("matchingCategories", []string{"foo"}).Return([]string{"Test Service"})
+	registry.On("areResilient", mock.MatchedBy(any)).Return(false)
+
+	env := "test"
+	controller := NewController(registry, &env)
+	controller.selfChecks = NewAggregatorHealth()
+	controller.selfChecks.etcdRead("services", errors.New("etcd is down"))
+
+	req, _ := http.NewRequest("GET", "http://www.example.com/__health?categories=foo&cache=false", nil)
+	w := httptest.NewRecorder()
+	controller.jsonHandler(w, req)
+
+	var response measuredHealthResult
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, response.Ok, "failing self-checks shouldn't affect the health of the cluster")
+	assert.Len(t, response.Checks, 6)
+	for _, check := range response.Checks[1:] {
+		assert.True(t, strings.HasPrefix(check.Name, selfCheckPrefix), check.Name)
+		assert.Equal(t, check.Name != selfCheckPrefix+"etcd", check.Ok, check.Name)
+	}
+}
+
 func TestHandleGtgForDisabledCategory(t *testing.T) {
 	registry := new(MockRegistry)
 	mockCategories(registry, []string{"foo"}, []string{"bar"})
@@ -246,7 +282,6 @@ func TestHandleGtgForDisabledCategory(t *testing.T) {
 }
 
 func TestHandleGtgUnhealthySetsDisabledIfSticky(t *testing.T) {
-	initLogs(os.Stdout, os.Stdout, os.Stderr)
 	any := func(x interface{}) bool { return true }
 
 	registry := new(MockRegistry)
@@ -276,7 +311,6 @@ func TestHandleGtgUnhealthySetsDisabledIfSticky(t *testing.T) {
 }
 
 func TestHandleGtgUnhealthySetsUnhealthyCategoriesOnlyDisabled(t *testing.T) {
-	initLogs(os.Stdout, os.Stdout, os.Stderr)
 	any := func(x interface{}) bool { return true }
 
 	registry := new(MockRegistry)
@@ -305,3 +339,44 @@ func TestHandleGtgUnhealthySetsUnhealthyCategoriesOnlyDisabled(t *testing.T) {
 	assert.Equal(t, http.StatusServiceUnavailable, w.Code, "HTTP status")
 	registry.AssertExpectations(t)
 }
+
+func TestHandleAggHealthcheckFromCache(t *testing.T) {
+	registry := new(MockRegistry)
+
+	withSystemCode := NewMeasuredService(&Service{Name: "foo-service-1"})
+	withoutSystemCode := NewMeasuredService(&Service{Name: "bar-service-1", SystemCode: "up-bar"})
+	notChecked := NewMeasuredService(&Service{Name: "baz-service-1"})
+	withSystemCode.cachedHealth.toWriteToCache <- MeasuredHealth{
+		HealthResult: fthealth.HealthResult{Checks: []fthealth.CheckResult{{Name: "foo-service-1", Ok: false}}},
+		Healthcheck:  &healthcheckResponse{SystemCode: "up-foo", Checks: []check{{ID: "db", Name: "Database", CheckOutput: "connection refused"}}},
+	}
+	withoutSystemCode.cachedHealth.toWriteToCache <- MeasuredHealth{
+		HealthResult: fthealth.HealthResult{Checks: []fthealth.CheckResult{{Name: "bar-service-1", Ok: true}}},
+		Healthcheck:  &healthcheckResponse{Checks: []check{{Name: "queue", OK: true}}},
+	}
+	registry.On("measuredServices").Return(map[string]MeasuredService{"foo-service-1": withSystemCode, "bar-service-1": withoutSystemCode, "baz-service-1": notChecked})
+
+	env := "test"
+	controller := NewController(registry, &env)
+
+	req, _ := http.NewRequest("GET", "http://www.example.com/__agghealth", nil)
+	w := httptest.NewRecorder()
+	controller.handleAggHealthcheck(w, req)
+
+	var response struct {
+		Checks []check `json:"checks"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.Checks, 2)
+	for _, check := range response.Checks {
+		switch check.ID {
+		case "db":
+			assert.Equal(t, "up-foo", check.CheckSystemCode)
+			assert.Equal(t, "connection refused", check.CheckOutput)
+		case "queue":
+			assert.Equal(t, "up-bar", check.CheckSystemCode, "the system code in etcd is the fallback")
+		default:
+			t.Errorf("unexpected check %v", check.ID)
+		}
+	}
+}
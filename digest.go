@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"mime/multipart"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type digestEntry struct {
+	Time       string
+	Summary    string
+	Output     string
+	PanicGuide string
+	IsHealthy  bool
+	IsSlow     bool
+	IsCritical bool
+	IsAcked    bool
+}
+
+type digest struct {
+	Environment string
+	Categories  string
+	Entries     []digestEntry
+}
+
+// maxUnsentDigestEntries bounds the notifications kept for a recipient whose digests can't be sent, the oldest
+// ones being dropped first.
+const maxUnsentDigestEntries = 500
+
+// DigestSink batches notifications over a window and emails a digest of them to the recipients configured
+// for their categories. Notifications not tied to any category are sent to every recipient. The digests that
+// can't be sent are kept, to be sent along with the next ones.
+type DigestSink struct {
+	sync.Mutex
+	smtpAddr string
+	auth     smtp.Auth
+	from     string
+	registry ServiceRegistry
+	pending  []Notification
+	// notifications of the digests that couldn't be sent, by recipient, only accessed by flush
+	unsent map[string][]Notification
+}
+
+func NewDigestSink(smtpAddr string, auth smtp.Auth, from string, registry ServiceRegistry) *DigestSink {
+	return &DigestSink{smtpAddr: smtpAddr, auth: auth, from: from, registry: registry, unsent: make(map[string][]Notification)}
+}
+
+func (s *DigestSink) Name() string {
+	return "email digest"
+}
+
+func (s *DigestSink) Send(notification Notification) error {
+	s.Lock()
+	defer s.Unlock()
+	s.pending = append(s.pending, notification)
+	return nil
+}
+
+// sendDigests flushes the digests at the end of every window, reporting the ones that can't be sent in the
+// status of the delivery of the sink.
+func (s *DigestSink) sendDigests(window time.Duration, delivery *sinkDelivery) {
+	ticker := time.NewTicker(window)
+	for range ticker.C {
+		if err := s.flush(); err != nil {
+			delivery.recordFailure(err)
+		}
+	}
+}
+
+func (s *DigestSink) flush() error {
+	s.Lock()
+	notifications := s.pending
+	s.pending = nil
+	s.Unlock()
+	if len(notifications) == 0 && len(s.unsent) == 0 {
+		return nil
+	}
+
+	var failures []string
+	for recipient, categories := range s.recipients() {
+		digested := s.unsent[recipient]
+		for _, n := range notifications {
+			if len(n.Categories) == 0 || containsAtLeastOneFrom(categories, n.Categories) {
+				digested = append(digested, n)
+			}
+		}
+		if len(digested) == 0 {
+			continue
+		}
+		if err := s.sendDigest(recipient, categories, digested); err != nil {
+			warnLogger.Printf("Failed to send email digest to %v, keeping it for the next one: [%v]", recipient, err.Error())
+			if len(digested) > maxUnsentDigestEntries {
+				digested = digested[len(digested)-maxUnsentDigestEntries:]
+			}
+			s.unsent[recipient] = digested
+			failures = append(failures, fmt.Sprintf("%v: %v", recipient, err.Error()))
+			continue
+		}
+		delete(s.unsent, recipient)
+	}
+	if len(failures) > 0 {
+		sort.Strings(failures)
+		return fmt.Errorf("Failed to send email digests to %v", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// recipients maps every configured recipient to the categories they are interested in.
+func (s *DigestSink) recipients() map[string][]string {
+	recipients := make(map[string][]string)
+	for _, category := range s.registry.categories() {
+		for _, recipient := range category.EmailRecipients {
+			recipients[recipient] = append(recipients[recipient], category.Name)
+		}
+	}
+	for _, categories := range recipients {
+		sort.Strings(categories)
+	}
+	return recipients
+}
+
+func (s *DigestSink) sendDigest(recipient string, categories []string, notifications []Notification) error {
+	d := digest{Categories: strings.Join(categories, ", ")}
+	for _, n := range notifications {
+		d.Environment = n.Environment
+		d.Entries = append(d.Entries, digestEntry{
+			Time:       n.Time.Format(timeLayout),
+			Summary:    n.summary(),
+			Output:     n.Output,
+			PanicGuide: n.PanicGuide,
+			IsHealthy:  n.Ok,
+			IsSlow:     n.Slow,
+			IsCritical: n.Severity == 1 || n.Event == categoryDisabled,
+			IsAcked:    n.Ack != "",
+		})
+	}
+
+	message, err := formatDigest(s.from, recipient, d)
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(s.smtpAddr, s.auth, s.from, []string{recipient}, message)
+}
+
+func formatDigest(from string, to string, d digest) ([]byte, error) {
+	digestTemplate, err := template.ParseFiles("digest.html", "styles.html")
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't open template file for email digest: %v", err.Error())
+	}
+	var html bytes.Buffer
+	if err := digestTemplate.Execute(&html, d); err != nil {
+		return nil, fmt.Errorf("Couldn't render template file for email digest: %v", err.Error())
+	}
+
+	var text bytes.Buffer
+	fmt.Fprintf(&text, "CoCo %s cluster's %s services changed %d times\r\n\r\n", d.Environment, d.Categories, len(d.Entries))
+	for _, entry := range d.Entries {
+		fmt.Fprintf(&text, "%s  %s\r\n", entry.Time, entry.Summary)
+		if entry.Output != "" {
+			fmt.Fprintf(&text, "          %s\r\n", entry.Output)
+		}
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{{"text/plain; charset=UTF-8", text.Bytes()}, {"text/html; charset=UTF-8", html.Bytes()}} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+		if err != nil {
+			return nil, err
+		}
+		w.Write(part.content)
+	}
+	parts.Close()
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", from)
+	fmt.Fprintf(&message, "To: %s\r\n", to)
+	fmt.Fprintf(&message, "Subject: CoCo %s healthcheck digest: %d changes\r\n", d.Environment, len(d.Entries))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type smtpMail struct {
+	from string
+	to   []string
+	data string
+}
+
+// startSMTPStandIn accepts mails on a local port, speaking just enough SMTP for net/smtp.
+func startSMTPStandIn(t *testing.T) (string, chan smtpMail) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mails := make(chan smtpMail, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, mails)
+		}
+	}()
+	return listener.Addr().String(), mails
+}
+
+func serveSMTP(conn net.Conn, mails chan smtpMail) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n"))
+	}
+	reply("220 localhost ESMTP stand-in")
+	var mail smtpMail
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			mail.from = strings.Trim(strings.TrimSpace(line)[len("MAIL FROM:"):], "<>")
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			mail.to = append(mail.to, strings.Trim(strings.TrimSpace(line)[len("RCPT TO:"):], "<>"))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data []string
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data = append(data, dataLine)
+			}
+			mail.data = strings.Join(data, "")
+			mails <- mail
+			mail = smtpMail{}
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func nextMail(t *testing.T, mails chan smtpMail) smtpMail {
+	select {
+	case mail := <-mails:
+		return mail
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected an email")
+	}
+	return smtpMail{}
+}
+
+func TestDigestSinkSendsDigestPerRecipient(t *testing.T) {
+	addr, mails := startSMTPStandIn(t)
+
+	registry := new(MockRegistry)
+	registry.On("categories").Return(map[string]Category{
+		"default": {Name: "default"},
+		"read":    {Name: "read", EmailRecipients: []string{"read-team@example.com"}},
+	})
+
+	sink := NewDigestSink(addr, nil, "aggregate-healthcheck@example.com", registry)
+	sink.Send(Notification{Event: serviceStateChanged, Environment: "prod-uk", Service: "foo-service-1", Categories: []string{"default", "read"}, Severity: 1, Output: "db unreachable", Time: time.Now()})
+	sink.Send(Notification{Event: serviceStateChanged, Environment: "prod-uk", Service: "bar-service-1", Categories: []string{"default"}, Severity: 2, Time: time.Now()})
+	sink.Send(Notification{Event: clusterAcked, Environment: "prod-uk", Ack: "release", Time: time.Now()})
+	sink.flush()
+
+	mail := nextMail(t, mails)
+	assert.Equal(t, "aggregate-healthcheck@example.com", mail.from)
+	assert.Equal(t, []string{"read-team@example.com"}, mail.to)
+	assert.Contains(t, mail.data, "Subject: CoCo prod-uk healthcheck digest: 2 changes")
+	assert.Contains(t, mail.data, "Content-Type: multipart/alternative")
+	assert.Contains(t, mail.data, "Content-Type: text/plain; charset=UTF-8")
+	assert.Contains(t, mail.data, "Content-Type: text/html; charset=UTF-8")
+	assert.Contains(t, mail.data, "foo-service-1 is unhealthy in prod-uk")
+	assert.Contains(t, mail.data, "db unreachable")
+	assert.Contains(t, mail.data, "<span class=\"critical\">CRITICAL</span>")
+	assert.Contains(t, mail.data, "prod-uk cluster has been acked: release")
+	assert.NotContains(t, mail.data, "bar-service-1", "the recipient doesn't watch the default category")
+}
+
+func TestDigestSinkSkipsEmptyWindows(t *testing.T) {
+	addr, mails := startSMTPStandIn(t)
+
+	registry := new(MockRegistry)
+	registry.On("categories").Return(map[string]Category{
+		"read": {Name: "read", EmailRecipients: []string{"read-team@example.com"}},
+	})
+
+	sink := NewDigestSink(addr, nil, "aggregate-healthcheck@example.com", registry)
+	sink.flush()
+
+	select {
+	case <-mails:
+		t.Fatal("no digest expected without notifications")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestDigestSinkKeepsUnsentDigests(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	unreachable := listener.Addr().String()
+	listener.Close()
+
+	registry := new(MockRegistry)
+	registry.On("categories").Return(map[string]Category{
+		"read": {Name: "read", EmailRecipients: []string{"read-team@example.com"}},
+	})
+
+	sink := NewDigestSink(unreachable, nil, "aggregate-healthcheck@example.com", registry)
+	sink.Send(Notification{Event: serviceStateChanged, Environment: "prod-uk", Service: "foo-service-1", Categories: []string{"read"}, Severity: 1, Time: time.Now()})
+	err = sink.flush()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "read-team@example.com")
+
+	addr, mails := startSMTPStandIn(t)
+	sink.smtpAddr = addr
+	sink.Send(Notification{Event: serviceStateChanged, Environment: "prod-uk", Service: "bar-service-1", Categories: []string{"read"}, Severity: 2, Time: time.Now()})
+	assert.NoError(t, sink.flush())
+
+	mail := nextMail(t, mails)
+	assert.Contains(t, mail.data, "Subject: CoCo prod-uk healthcheck digest: 2 changes")
+	assert.Contains(t, mail.data, "foo-service-1 is unhealthy in prod-uk", "the unsent digest is sent along with the next one")
+	assert.Contains(t, mail.data, "bar-service-1 is unhealthy in prod-uk")
+
+	assert.NoError(t, sink.flush())
+	select {
+	case <-mails:
+		t.Fatal("the digest was sent already")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
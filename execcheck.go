@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultExecTimeout   = 10 * time.Second
+	defaultExecPluginDir = "/usr/lib/nagios/plugins"
+	nagiosOK             = 0
+	nagiosWarning        = 1
+	nagiosCritical       = 2
+	nagiosUnknown        = 3
+)
+
+// nagiosSeverities are the severities of the failing exit codes of Nagios plugins, 1 being critical and 2 a warning.
+var nagiosSeverities = map[int]uint8{
+	nagiosWarning:  2,
+	nagiosCritical: 1,
+	nagiosUnknown:  2,
+}
+
+var nagiosStates = map[int]string{
+	nagiosOK:       "OK",
+	nagiosWarning:  "WARNING",
+	nagiosCritical: "CRITICAL",
+	nagiosUnknown:  "UNKNOWN",
+}
+
+// ExecChecker checks services by running the Nagios plugins of the plugin directory, at most maxConcurrent
+// at a time.
+type ExecChecker struct {
+	pluginDir string
+	slots     chan struct{}
+}
+
+// execConfig are the settings of exec checks: command, the plugin and its arguments separated by spaces,
+// and timeout_seconds.
+type execConfig struct {
+	command string
+	timeout time.Duration
+}
+
+func NewExecChecker(pluginDir string, maxConcurrent int) *ExecChecker {
+	if maxConcurrent <= 0 {
+		maxConcurrent = 1
+	}
+	if dir, err := filepath.Abs(pluginDir); err == nil {
+		pluginDir = dir
+	}
+	return &ExecChecker{pluginDir: filepath.Clean(pluginDir), slots: make(chan struct{}, maxConcurrent)}
+}
+
+func parseExecConfig(service Service) (execConfig, error) {
+	command, err := service.setting("command")
+	if err != nil {
+		return execConfig{}, err
+	}
+	timeout, err := service.settingSeconds("timeout_seconds", defaultExecTimeout)
+	if err != nil {
+		return execConfig{}, err
+	}
+	return execConfig{command: command, timeout: timeout}, nil
+}
+
+// pluginCommand is the path of the plugin of the command and its arguments, the plugin being either
+// relative to the plugin directory or an absolute path within it.
+func (c *ExecChecker) pluginCommand(service Service, command string) (string, []string, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return "", nil, fmt.Errorf("Missing setting %v/command of %v checks", service.ServiceKey, service.CheckType)
+	}
+	plugin := args[0]
+	if !filepath.IsAbs(plugin) {
+		plugin = filepath.Join(c.pluginDir, plugin)
+	}
+	plugin = filepath.Clean(plugin)
+	if !strings.HasPrefix(plugin, c.pluginDir+string(filepath.Separator)) {
+		return "", nil, fmt.Errorf("Invalid setting %v/command '%v', the plugin must be in %v", service.ServiceKey, command, c.pluginDir)
+	}
+	return plugin, args[1:], nil
+}
+
+// Check runs the plugin of the service, mapping its exit code to the health of the service: 0 is OK, while
+// 1, 2 and 3 are failures with a warning, critical and unknown severity. The time spent waiting for
+// another plugin to finish counts towards the timeout.
+func (c *ExecChecker) Check(service Service) (string, error) {
+	config, err := parseExecConfig(service)
+	if err != nil {
+		return "", err
+	}
+	plugin, args, err := c.pluginCommand(service, config.command)
+	if err != nil {
+		return "", err
+	}
+	deadline := time.Now().Add(config.timeout)
+	select {
+	case c.slots <- struct{}{}:
+		defer func() { <-c.slots }()
+	case <-time.After(config.timeout):
+		return "", &severityError{nagiosSeverities[nagiosUnknown], fmt.Sprintf("UNKNOWN - no plugin finished within %v to make room for this one", config.timeout)}
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.Command(plugin, args...)
+	cmd.Stdout = &stdout
+	// in its own process group, to kill the plugin along with whatever it started
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return "", &severityError{nagiosSeverities[nagiosUnknown], fmt.Sprintf("UNKNOWN - can't run plugin: %v", err.Error())}
+	}
+	timer := time.AfterFunc(time.Until(deadline), func() {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	})
+	err = cmd.Wait()
+	if !timer.Stop() {
+		return "", &severityError{nagiosSeverities[nagiosCritical], fmt.Sprintf("CRITICAL - plugin timed out after %v", config.timeout)}
+	}
+	output := pluginOutput(stdout.Bytes())
+	code := nagiosOK
+	if err != nil {
+		code = exitCode(err)
+	}
+	if code == nagiosOK {
+		return output, nil
+	}
+	severity, known := nagiosSeverities[code]
+	if !known {
+		severity = nagiosSeverities[nagiosUnknown]
+		code = nagiosUnknown
+	}
+	if output == "" {
+		output = fmt.Sprintf("%v - plugin exited with %v", nagiosStates[code], err.Error())
+	}
+	return "", &severityError{severity, output}
+}
+
+// pluginOutput is the first line of the output of a plugin, without its performance data.
+func pluginOutput(stdout []byte) string {
+	line, _ := bufio.NewReader(bytes.NewReader(stdout)).ReadString('\n')
+	if i := strings.Index(line, "|"); i >= 0 {
+		line = line[:i]
+	}
+	return strings.TrimSpace(line)
+}
+
+// exitCode is the exit code of a plugin that didn't succeed, unknown if it couldn't run at all.
+func exitCode(err error) int {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return status.ExitStatus()
+		}
+	}
+	return nagiosUnknown
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// pluginDir is a temporary plugin directory with the plugins of the tests.
+func pluginDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "plugins")
+	assert.NoError(t, err)
+	plugins := map[string]string{
+		"check_ftp":   "echo 'FTP OK - 0.1 second response time | time=0.1s'; echo second line",
+		"check_exit":  "echo 'DISK PROBLEM'; exit $1",
+		"check_quiet": "exit $1",
+		"check_sleep": "sleep $1",
+	}
+	for name, script := range plugins {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script+"\n"), 0755))
+	}
+	return dir
+}
+
+func execService(command string) Service {
+	return Service{Name: "legacy", ServiceKey: "/ft/healthcheck/legacy", CheckType: execCheckType, Settings: map[string]string{"command": command}}
+}
+
+func TestExecCheckOK(t *testing.T) {
+	dir := pluginDir(t)
+	defer os.RemoveAll(dir)
+
+	output, err := NewExecChecker(dir, 1).Check(execService("check_ftp -H ftp.example.com"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "FTP OK - 0.1 second response time", output)
+}
+
+func TestExecCheckExitCodes(t *testing.T) {
+	dir := pluginDir(t)
+	defer os.RemoveAll(dir)
+
+	for code, severity := range map[string]uint8{"1": 2, "2": 1, "3": 2, "42": 2} {
+		_, err := NewExecChecker(dir, 1).Check(execService(filepath.Join(dir, "check_exit") + " " + code))
+
+		assert.EqualError(t, err, "DISK PROBLEM")
+		if assert.IsType(t, &severityError{}, err) {
+			assert.Equal(t, severity, err.(*severityError).severity, "severity of exit code %v", code)
+		}
+	}
+}
+
+func TestExecCheckWithoutOutput(t *testing.T) {
+	dir := pluginDir(t)
+	defer os.RemoveAll(dir)
+
+	_, err := NewExecChecker(dir, 1).Check(execService("check_quiet 2"))
+
+	assert.EqualError(t, err, "CRITICAL - plugin exited with exit status 2")
+}
+
+func TestExecCheckTimeout(t *testing.T) {
+	dir := pluginDir(t)
+	defer os.RemoveAll(dir)
+	service := execService("check_sleep 5")
+	service.Settings["timeout_seconds"] = "0.1"
+
+	start := time.Now()
+	_, err := NewExecChecker(dir, 1).Check(service)
+
+	assert.EqualError(t, err, "CRITICAL - plugin timed out after 100ms")
+	assert.True(t, time.Since(start) < 5*time.Second, "the plugin should be killed")
+}
+
+func TestExecCheckWithoutFreeSlot(t *testing.T) {
+	dir := pluginDir(t)
+	defer os.RemoveAll(dir)
+	checker := NewExecChecker(dir, 1)
+	checker.slots <- struct{}{}
+	service := execService("check_ftp")
+	service.Settings["timeout_seconds"] = "0.1"
+
+	_, err := checker.Check(service)
+
+	assert.EqualError(t, err, "UNKNOWN - no plugin finished within 100ms to make room for this one")
+	if assert.IsType(t, &severityError{}, err) {
+		assert.Equal(t, uint8(2), err.(*severityError).severity)
+	}
+}
+
+func TestExecCheckPluginOutsideOfPluginDir(t *testing.T) {
+	dir := pluginDir(t)
+	defer os.RemoveAll(dir)
+
+	for _, command := range []string{"/bin/echo OK", "../check_ftp", dir + "/../check_ftp", dir} {
+		_, err := NewExecChecker(dir, 1).Check(execService(command))
+
+		assert.EqualError(t, err, "Invalid setting /ft/healthcheck/legacy/command '"+command+"', the plugin must be in "+dir)
+	}
+}
+
+func TestExecCheckMissingCommand(t *testing.T) {
+	_, err := NewExecChecker(defaultExecPluginDir, 1).Check(Service{Name: "legacy", ServiceKey: "/ft/healthcheck/legacy", CheckType: execCheckType})
+
+	assert.EqualError(t, err, "Missing setting /ft/healthcheck/legacy/command of exec checks")
+}
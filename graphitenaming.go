@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+const (
+	defaultGraphitePrefix                = "coco.health"
+	defaultGraphitePilotTemplate         = "{{.Prefix}}.{{.Environment}}.pilot-light"
+	defaultGraphiteServiceTemplate       = "{{.Prefix}}.{{.Environment}}.services.{{.Service}}"
+	defaultGraphiteServiceSeriesTemplate = "{{.Prefix}}.{{.Environment}}.services-{{.Metric}}.{{.Service}}"
+	defaultGraphiteCategoryTemplate      = "{{.Prefix}}.{{.Environment}}.categories.{{.Category}}"
+	defaultGraphiteClusterTemplate       = "{{.Prefix}}.{{.Environment}}.cluster"
+	latencySeries                        = "latency"
+	severitySeries                       = "severity"
+	ackedSeries                          = "acked"
+)
+
+// GraphiteTemplates are the templates of the Graphite paths of every kind of metric.
+type GraphiteTemplates struct {
+	Pilot         string
+	Service       string
+	ServiceSeries string
+	Category      string
+	Cluster       string
+}
+
+var defaultGraphiteTemplates = GraphiteTemplates{
+	Pilot:         defaultGraphitePilotTemplate,
+	Service:       defaultGraphiteServiceTemplate,
+	ServiceSeries: defaultGraphiteServiceSeriesTemplate,
+	Category:      defaultGraphiteCategoryTemplate,
+	Cluster:       defaultGraphiteClusterTemplate,
+}
+
+// graphiteNameFields are the fields available to the Graphite naming templates.
+type graphiteNameFields struct {
+	Prefix       string
+	Environment  string
+	Category     string
+	Service      string
+	ServiceGroup string
+	Instance     string
+	Metric       string
+}
+
+// GraphiteNaming builds the Graphite paths of the metrics from templates.
+type GraphiteNaming struct {
+	prefix                string
+	environment           string
+	pilotTemplate         *template.Template
+	serviceTemplate       *template.Template
+	serviceSeriesTemplate *template.Template
+	categoryTemplate      *template.Template
+	clusterTemplate       *template.Template
+}
+
+func NewGraphiteNaming(prefix string, environment string, templates GraphiteTemplates) (*GraphiteNaming, error) {
+	naming := &GraphiteNaming{prefix: prefix, environment: environment}
+	parsed := []struct {
+		name     string
+		text     string
+		template **template.Template
+	}{
+		{"pilot light", templates.Pilot, &naming.pilotTemplate},
+		{"service", templates.Service, &naming.serviceTemplate},
+		{"service series", templates.ServiceSeries, &naming.serviceSeriesTemplate},
+		{"category", templates.Category, &naming.categoryTemplate},
+		{"cluster", templates.Cluster, &naming.clusterTemplate},
+	}
+	for _, p := range parsed {
+		t, err := template.New(p.name).Parse(p.text)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid Graphite %v template: %v", p.name, err.Error())
+		}
+		*p.template = t
+	}
+
+	sample := Service{Name: "service-1", Categories: []string{defaultCategoryName}}
+	if _, err := naming.pilotLightPath(); err != nil {
+		return nil, err
+	}
+	if _, err := naming.servicePaths(sample); err != nil {
+		return nil, err
+	}
+	if _, err := naming.serviceSeriesPaths(sample, latencySeries); err != nil {
+		return nil, err
+	}
+	if _, err := naming.categoryPath(defaultCategoryName); err != nil {
+		return nil, err
+	}
+	if _, err := naming.clusterPath(); err != nil {
+		return nil, err
+	}
+	return naming, nil
+}
+
+func (n *GraphiteNaming) pilotLightPath() (string, error) {
+	return n.render(n.pilotTemplate, graphiteNameFields{Prefix: n.prefix, Environment: n.environment})
+}
+
+func (n *GraphiteNaming) clusterPath() (string, error) {
+	return n.render(n.clusterTemplate, graphiteNameFields{Prefix: n.prefix, Environment: n.environment})
+}
+
+func (n *GraphiteNaming) categoryPath(category string) (string, error) {
+	return n.render(n.categoryTemplate, graphiteNameFields{Prefix: n.prefix, Environment: n.environment, Category: sanitiseGraphiteNode(category)})
+}
+
+// servicePaths are the paths of the metrics of the service, one for every category of the service
+// if the template depends on the category.
+func (n *GraphiteNaming) servicePaths(service Service) ([]string, error) {
+	return n.renderForCategories(n.serviceTemplate, service, "")
+}
+
+// serviceSeriesPaths are the paths of the given series of the service, like its latency.
+func (n *GraphiteNaming) serviceSeriesPaths(service Service, metric string) ([]string, error) {
+	return n.renderForCategories(n.serviceSeriesTemplate, service, metric)
+}
+
+func (n *GraphiteNaming) renderForCategories(t *template.Template, service Service, metric string) ([]string, error) {
+	group, instance := splitServiceInstance(service.Name)
+	fields := graphiteNameFields{
+		Prefix:       n.prefix,
+		Environment:  n.environment,
+		Service:      sanitiseGraphiteNode(service.Name),
+		ServiceGroup: sanitiseGraphiteNode(group),
+		Instance:     sanitiseGraphiteNode(instance),
+		Metric:       metric,
+	}
+	categories := service.Categories
+	if len(categories) == 0 {
+		categories = []string{defaultCategoryName}
+	}
+
+	var paths []string
+	seen := make(map[string]bool)
+	for _, category := range categories {
+		fields.Category = sanitiseGraphiteNode(category)
+		path, err := n.render(t, fields)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+func (n *GraphiteNaming) render(t *template.Template, fields graphiteNameFields) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, fields); err != nil {
+		return "", fmt.Errorf("Can't build Graphite metric name: %v", err.Error())
+	}
+	return buf.String(), nil
+}
+
+// splitServiceInstance splits names like foo-service-1 into the service group foo-service and the instance 1.
+func splitServiceInstance(name string) (string, string) {
+	loc := serverInstanceRegex.FindStringIndex(name)
+	if loc == nil {
+		return name, ""
+	}
+	return name[:loc[0]], name[loc[0]+1:]
+}
+
+// sanitiseGraphiteNode replaces the characters separating or breaking Graphite path nodes.
+func sanitiseGraphiteNode(node string) string {
+	return graphiteNodeReplacer.Replace(node)
+}
+
+var graphiteNodeReplacer = strings.NewReplacer(".", "-", " ", "_")
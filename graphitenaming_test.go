@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultGraphiteNaming(t *testing.T) {
+	naming, err := NewGraphiteNaming(defaultGraphitePrefix, "test", defaultGraphiteTemplates)
+	assert.NoError(t, err)
+
+	pilot, _ := naming.pilotLightPath()
+	assert.Equal(t, "coco.health.test.pilot-light", pilot)
+	paths, _ := naming.servicePaths(Service{Name: "foo.service-1", Categories: []string{"default", "read"}})
+	assert.Equal(t, []string{"coco.health.test.services.foo-service-1"}, paths)
+	paths, _ = naming.serviceSeriesPaths(Service{Name: "foo.service-1", Categories: []string{"default", "read"}}, latencySeries)
+	assert.Equal(t, []string{"coco.health.test.services-latency.foo-service-1"}, paths)
+	category, _ := naming.categoryPath("read")
+	assert.Equal(t, "coco.health.test.categories.read", category)
+	cluster, _ := naming.clusterPath()
+	assert.Equal(t, "coco.health.test.cluster", cluster)
+}
+
+func TestGraphiteNamingByCategoryAndInstance(t *testing.T) {
+	templates := defaultGraphiteTemplates
+	templates.Service = "{{.Prefix}}.{{.Environment}}.{{.Category}}.{{.ServiceGroup}}.{{.Instance}}"
+	naming, err := NewGraphiteNaming("health", "prod", templates)
+	assert.NoError(t, err)
+
+	paths, _ := naming.servicePaths(Service{Name: "foo-service-2", Categories: []string{"default", "read"}})
+	assert.Equal(t, []string{"health.prod.default.foo-service.2", "health.prod.read.foo-service.2"}, paths)
+}
+
+func TestGraphiteNamingRejectsInvalidTemplates(t *testing.T) {
+	templates := defaultGraphiteTemplates
+	templates.Service = "{{.Prefix}.{{.Environment}}"
+	_, err := NewGraphiteNaming("health", "prod", templates)
+	assert.Error(t, err)
+
+	templates = defaultGraphiteTemplates
+	templates.Cluster = "{{.Prefix}}.{{.Cluster}}"
+	_, err = NewGraphiteNaming("health", "prod", templates)
+	assert.Error(t, err)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"sort"
+)
+
+const maxPendingGraphiteMetrics = 100000
+
+// GraphiteSink sends the health metrics to a Graphite host. The metrics it fails to send are spooled if
+// enabled, or kept in memory otherwise, and sent again after reconnecting.
+type GraphiteSink struct {
+	naming    *GraphiteNaming
+	transport GraphiteTransport
+	batchSize int
+	spool     *GraphiteSpool
+	pending   []graphiteMetric
+}
+
+func NewGraphiteSink(transport GraphiteTransport, naming *GraphiteNaming, batchSize int) *GraphiteSink {
+	g := &GraphiteSink{naming: naming, transport: transport, batchSize: batchSize}
+	connectSink(g.Name(), transport)
+	return g
+}
+
+func (g *GraphiteSink) Name() string {
+	return "graphite " + g.transport.address()
+}
+
+func (g *GraphiteSink) Send(snapshot HealthSnapshot) error {
+	metrics := append(g.pending, graphiteMetricsFor(g.naming, snapshot)...)
+	g.pending = nil
+	err := g.flush(metrics)
+	if err != nil {
+		selfMetrics.sinkFailures.inc(g.Name())
+		reconnectSink(g.Name(), g.transport)
+		if err := g.replaySpool(); err != nil {
+			warnLogger.Printf("[%v]", err.Error())
+		}
+	}
+	selfHealth.sinkBacklog(g.Name(), len(g.pending), maxPendingGraphiteMetrics)
+	return err
+}
+
+// flush sends the metrics in batches, after the spooled ones if any.
+func (g *GraphiteSink) flush(metrics []graphiteMetric) error {
+	if err := g.replaySpool(); err != nil {
+		g.keep(metrics)
+		return err
+	}
+	sent, err := g.send(metrics)
+	if err != nil {
+		g.keep(metrics[sent:])
+		return err
+	}
+	return nil
+}
+
+// keep spools the metrics if enabled, or keeps them in memory otherwise, dropping the oldest ones once full.
+func (g *GraphiteSink) keep(metrics []graphiteMetric) {
+	if g.spool != nil {
+		if err := g.spool.add(metrics...); err != nil {
+			warnLogger.Printf("[%v]", err.Error())
+		}
+		return
+	}
+	g.pending = append(g.pending, metrics...)
+	if excess := excessPending(g.Name(), len(g.pending), maxPendingGraphiteMetrics); excess > 0 {
+		g.pending = append([]graphiteMetric(nil), g.pending[excess:]...)
+	}
+}
+
+// send sends the metrics in batches, returning how many were sent.
+func (g *GraphiteSink) send(metrics []graphiteMetric) (int, error) {
+	return sendInBatches(len(metrics), g.batchSize, func(from, to int) error {
+		return g.transport.send(metrics[from:to])
+	})
+}
+
+// replaySpool sends the spooled metrics, if any, before the new ones.
+func (g *GraphiteSink) replaySpool() error {
+	if g.spool == nil || g.spool.isEmpty() {
+		return nil
+	}
+	if !g.transport.isConnected() {
+		return errors.New("Can't replay spooled results, no Graphite connection.")
+	}
+	return g.spool.replay(g.send)
+}
+
+// graphiteMetricsFor are the metrics of the snapshot named as Graphite paths: the pilot light, the metrics
+// of every service check, and the health of every category and of the cluster.
+func graphiteMetricsFor(naming *GraphiteNaming, snapshot HealthSnapshot) []graphiteMetric {
+	now := snapshot.Time.Unix()
+	var metrics []graphiteMetric
+	if path, err := naming.pilotLightPath(); err != nil {
+		warnLogger.Printf("[%v]", err.Error())
+	} else {
+		metrics = append(metrics, graphiteMetric{path, 1, now})
+	}
+
+	for _, result := range snapshot.Results {
+		resultMetrics, err := serviceGraphiteMetrics(naming, result.Service, result.Health)
+		if err != nil {
+			warnLogger.Printf("[%v]", err.Error())
+			continue
+		}
+		metrics = append(metrics, resultMetrics...)
+	}
+
+	var categories []string
+	for category := range snapshot.Categories {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		path, err := naming.categoryPath(category)
+		if err != nil {
+			warnLogger.Printf("[%v]", err.Error())
+			continue
+		}
+		metrics = append(metrics, graphiteMetric{path, float64(inverseBoolToInt(snapshot.Categories[category])), now})
+	}
+
+	if path, err := naming.clusterPath(); err != nil {
+		warnLogger.Printf("[%v]", err.Error())
+	} else {
+		metrics = append(metrics, graphiteMetric{path, float64(inverseBoolToInt(snapshot.ClusterHealth)), now})
+	}
+	return metrics
+}
+
+// serviceGraphiteMetrics are the metrics of a single check of the service: whether it failed, along with
+// its latency, severity and acked state.
+func serviceGraphiteMetrics(naming *GraphiteNaming, service Service, result MeasuredHealth) ([]graphiteMetric, error) {
+	check := result.Checks[0]
+	timestamp := check.LastUpdated.Unix()
+	paths, err := naming.servicePaths(service)
+	if err != nil {
+		return nil, err
+	}
+	var metrics []graphiteMetric
+	for _, path := range paths {
+		metrics = append(metrics, graphiteMetric{path, float64(inverseBoolToInt(check.Ok)), timestamp})
+	}
+	series := []struct {
+		name  string
+		value float64
+	}{
+		{latencySeries, result.Latency.Seconds()},
+		{severitySeries, float64(check.Severity)},
+		{ackedSeries, boolToFloat(check.Ack != "")},
+	}
+	for _, s := range series {
+		paths, err := naming.serviceSeriesPaths(service, s.name)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			metrics = append(metrics, graphiteMetric{path, s.value, timestamp})
+		}
+	}
+	return metrics, nil
+}
+
+func inverseBoolToInt(b bool) int {
+	if b {
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	fthealth "github.com/Financial-Times/go-fthealth/v1a"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockTransport struct {
+	sent      []graphiteMetric
+	connected bool
+}
+
+func (t *MockTransport) connect() error {
+	return nil
+}
+
+func (t *MockTransport) send(metrics []graphiteMetric) error {
+	if !t.connected {
+		return errors.New("no Graphite connection")
+	}
+	t.sent = append(t.sent, metrics...)
+	return nil
+}
+
+func (t *MockTransport) isConnected() bool {
+	return t.connected
+}
+
+func (t *MockTransport) address() string {
+	return "graphite:2003"
+}
+
+func TestServiceGraphiteMetrics(t *testing.T) {
+	naming, _ := NewGraphiteNaming(defaultGraphitePrefix, "test", defaultGraphiteTemplates)
+
+	lastUpdated := time.Unix(1500000000, 0)
+	metrics, err := serviceGraphiteMetrics(naming, Service{Name: "foo-service-1", Categories: []string{"default"}}, MeasuredHealth{
+		HealthResult: fthealth.HealthResult{Checks: []fthealth.CheckResult{{Name: "foo-service-1", Ok: false, Severity: 1, Ack: "on it", LastUpdated: lastUpdated}}},
+		Latency:      250 * time.Millisecond,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []graphiteMetric{
+		{"coco.health.test.services.foo-service-1", 1, 1500000000},
+		{"coco.health.test.services-latency.foo-service-1", 0.25, 1500000000},
+		{"coco.health.test.services-severity.foo-service-1", 1, 1500000000},
+		{"coco.health.test.services-acked.foo-service-1", 1, 1500000000},
+	}, metrics)
+}
+
+func TestGraphiteSinkKeepsMetricsUntilReconnected(t *testing.T) {
+	naming, _ := NewGraphiteNaming(defaultGraphitePrefix, "test", defaultGraphiteTemplates)
+	transport := &MockTransport{}
+	sink := NewGraphiteSink(transport, naming, 2)
+
+	first := HealthSnapshot{Time: time.Unix(1500000000, 0), Categories: map[string]bool{"read": true}, ClusterHealth: true}
+	assert.Error(t, sink.Send(first))
+	assert.Empty(t, transport.sent)
+
+	transport.connected = true
+	second := HealthSnapshot{Time: time.Unix(1500000060, 0), Categories: map[string]bool{"read": false}, ClusterHealth: false}
+	assert.NoError(t, sink.Send(second))
+	assert.Equal(t, []graphiteMetric{
+		{"coco.health.test.pilot-light", 1, 1500000000},
+		{"coco.health.test.categories.read", 0, 1500000000},
+		{"coco.health.test.cluster", 0, 1500000000},
+		{"coco.health.test.pilot-light", 1, 1500000060},
+		{"coco.health.test.categories.read", 1, 1500000060},
+		{"coco.health.test.cluster", 1, 1500000060},
+	}, transport.sent)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+// GraphiteSpool is an append-only file of the metric lines that couldn't be sent to Graphite,
+// to be replayed in order once Graphite is back. Lines exceeding its maximum size are dropped.
+type GraphiteSpool struct {
+	sync.Mutex
+	path     string
+	maxBytes int64
+	size     int64
+}
+
+func NewGraphiteSpool(path string, maxBytes int64) (*GraphiteSpool, error) {
+	spool := &GraphiteSpool{path: path, maxBytes: maxBytes}
+	info, err := os.Stat(path)
+	if err == nil {
+		spool.size = info.Size()
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	selfMetrics.spoolBytes.set(path, float64(spool.size))
+	return spool, nil
+}
+
+func (s *GraphiteSpool) add(metrics ...graphiteMetric) error {
+	s.Lock()
+	defer s.Unlock()
+
+	var buf bytes.Buffer
+	for _, metric := range metrics {
+		line := metric.String()
+		if s.size+int64(buf.Len()+len(line)) > s.maxBytes {
+			selfMetrics.spoolDrops.inc(s.path)
+			continue
+		}
+		buf.WriteString(line)
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("Can't open Graphite spool %v: %v", s.path, err.Error())
+	}
+	defer file.Close()
+	written, err := file.Write(buf.Bytes())
+	s.size += int64(written)
+	selfMetrics.spoolBytes.set(s.path, float64(s.size))
+	if err != nil {
+		return fmt.Errorf("Can't write to Graphite spool %v: %v", s.path, err.Error())
+	}
+	return nil
+}
+
+func (s *GraphiteSpool) isEmpty() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.size == 0
+}
+
+// replay sends the spooled metrics in order, keeping in the spool the ones that couldn't be sent.
+func (s *GraphiteSpool) replay(send func([]graphiteMetric) (int, error)) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.size == 0 {
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("Can't read Graphite spool %v: %v", s.path, err.Error())
+	}
+	var metrics []graphiteMetric
+	for _, line := range strings.Split(string(content), "\n") {
+		if line == "" {
+			continue
+		}
+		metric, err := parseGraphiteMetric(line)
+		if err != nil {
+			warnLogger.Printf("Skipping spooled metric: %v", err.Error())
+			continue
+		}
+		metrics = append(metrics, metric)
+	}
+
+	sent, sendErr := send(metrics)
+	var remaining bytes.Buffer
+	for _, metric := range metrics[sent:] {
+		remaining.WriteString(metric.String())
+	}
+	if err := ioutil.WriteFile(s.path, remaining.Bytes(), 0644); err != nil {
+		return fmt.Errorf("Can't rewrite Graphite spool %v: %v", s.path, err.Error())
+	}
+	s.size = int64(remaining.Len())
+	selfMetrics.spoolBytes.set(s.path, float64(s.size))
+	if sendErr != nil {
+		return fmt.Errorf("Error replaying Graphite spool: %v", sendErr.Error())
+	}
+	infoLogger.Printf("Replayed %d spooled metrics to Graphite.", sent)
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphiteSpoolReplaysInOrder(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "spool")
+	defer os.RemoveAll(dir)
+
+	spool, err := NewGraphiteSpool(filepath.Join(dir, "graphite.spool"), 1024)
+	assert.NoError(t, err)
+	assert.True(t, spool.isEmpty())
+	assert.NoError(t, spool.add(graphiteMetric{"a", 1, 1}, graphiteMetric{"b", 1, 2}))
+	assert.NoError(t, spool.add(graphiteMetric{"c", 0.5, 3}))
+
+	var replayed []graphiteMetric
+	assert.Error(t, spool.replay(func(metrics []graphiteMetric) (int, error) {
+		replayed = append(replayed, metrics[:2]...)
+		return 2, errors.New("connection reset")
+	}))
+	assert.Equal(t, []graphiteMetric{{"a", 1, 1}, {"b", 1, 2}}, replayed)
+	assert.False(t, spool.isEmpty())
+
+	replayed = nil
+	assert.NoError(t, spool.replay(func(metrics []graphiteMetric) (int, error) {
+		replayed = append(replayed, metrics...)
+		return len(metrics), nil
+	}))
+	assert.Equal(t, []graphiteMetric{{"c", 0.5, 3}}, replayed)
+	assert.True(t, spool.isEmpty())
+}
+
+func TestGraphiteSpoolDropsLinesOnceFull(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "spool")
+	defer os.RemoveAll(dir)
+
+	spool, _ := NewGraphiteSpool(filepath.Join(dir, "graphite.spool"), 10)
+	assert.NoError(t, spool.add(graphiteMetric{"a", 1, 1}, graphiteMetric{"b", 1, 2}))
+
+	content, _ := ioutil.ReadFile(filepath.Join(dir, "graphite.spool"))
+	assert.Equal(t, "a 1 1\n", string(content))
+}
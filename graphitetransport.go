@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	plaintextTCPProtocol = "plaintext-tcp"
+	plaintextUDPProtocol = "plaintext-udp"
+	pickleProtocol       = "pickle"
+	maxUDPPayload        = 1400
+)
+
+// graphiteMetric is a single data point sent to Graphite.
+type graphiteMetric struct {
+	path      string
+	value     float64
+	timestamp int64
+}
+
+func (m graphiteMetric) String() string {
+	return fmt.Sprintf("%s %s %d\n", m.path, formatValue(m.value), m.timestamp)
+}
+
+// parseGraphiteMetric reads a metric in the plaintext protocol format.
+func parseGraphiteMetric(line string) (graphiteMetric, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return graphiteMetric{}, fmt.Errorf("Invalid metric line '%v'", line)
+	}
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return graphiteMetric{}, fmt.Errorf("Invalid metric value in line '%v'", line)
+	}
+	timestamp, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return graphiteMetric{}, fmt.Errorf("Invalid metric timestamp in line '%v'", line)
+	}
+	return graphiteMetric{fields[0], value, timestamp}, nil
+}
+
+// parseGraphiteAddresses reads a comma-separated list of hosts, with or without ports.
+func parseGraphiteAddresses(hosts string, defaultPort int) ([]string, error) {
+	var addrs []string
+	for _, host := range strings.Split(hosts, ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, strconv.Itoa(defaultPort))
+		}
+		addrs = append(addrs, host)
+	}
+	if len(addrs) == 0 {
+		return nil, errors.New("No Graphite host configured")
+	}
+	return addrs, nil
+}
+
+// GraphiteTransport sends batches of metrics to Graphite.
+type GraphiteTransport interface {
+	sinkConnection
+	send(metrics []graphiteMetric) error
+}
+
+// connTransport writes every batch of metrics as one or more payloads over a network connection.
+type connTransport struct {
+	network string
+	addr    string
+	conn    net.Conn
+	encode  func([]graphiteMetric) [][]byte
+}
+
+func NewGraphiteTransport(protocol string, addr string) (GraphiteTransport, error) {
+	switch protocol {
+	case plaintextTCPProtocol:
+		return &connTransport{network: "tcp", addr: addr, encode: encodePlaintext}, nil
+	case plaintextUDPProtocol:
+		return &connTransport{network: "udp", addr: addr, encode: encodePlaintextDatagrams}, nil
+	case pickleProtocol:
+		return &connTransport{network: "tcp", addr: addr, encode: encodePickle}, nil
+	}
+	return nil, fmt.Errorf("Unknown Graphite protocol '%v', expecting one of %v, %v or %v", protocol, plaintextTCPProtocol, plaintextUDPProtocol, pickleProtocol)
+}
+
+func (t *connTransport) connect() error {
+	if t.conn != nil {
+		t.conn.Close()
+		t.conn = nil
+	}
+	conn, err := net.Dial(t.network, t.addr)
+	if err != nil {
+		return fmt.Errorf("Error while creating %v connection [%v]", strings.ToUpper(t.network), err)
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.SetKeepAlive(true)
+		tcpConn.SetKeepAlivePeriod(30 * time.Minute)
+	}
+	t.conn = conn
+	return nil
+}
+
+func (t *connTransport) send(metrics []graphiteMetric) error {
+	if t.conn == nil {
+		return errors.New("Can't send results, no Graphite connection.")
+	}
+	for _, payload := range t.encode(metrics) {
+		if _, err := t.conn.Write(payload); err != nil {
+			return fmt.Errorf("Error sending results to graphite: [%v]", err.Error())
+		}
+	}
+	return nil
+}
+
+func (t *connTransport) isConnected() bool {
+	return t.conn != nil
+}
+
+func (t *connTransport) address() string {
+	return t.addr
+}
+
+func encodePlaintext(metrics []graphiteMetric) [][]byte {
+	var buf bytes.Buffer
+	for _, metric := range metrics {
+		buf.WriteString(metric.String())
+	}
+	return [][]byte{buf.Bytes()}
+}
+
+// encodePlaintextDatagrams packs the plaintext lines of the metrics, which end with a newline, into datagrams.
+func encodePlaintextDatagrams(metrics []graphiteMetric) [][]byte {
+	lines := make([]string, len(metrics))
+	for i, metric := range metrics {
+		lines[i] = metric.String()
+	}
+	return packDatagrams(lines, "")
+}
+
+// packDatagrams packs whole lines, joined by the separator, into datagrams small enough not to get fragmented.
+// It is shared by every UDP transport, whatever the protocol of the lines.
+func packDatagrams(lines []string, separator string) [][]byte {
+	var datagrams [][]byte
+	var buf bytes.Buffer
+	for _, line := range lines {
+		if buf.Len() > 0 && buf.Len()+len(separator)+len(line) > maxUDPPayload {
+			datagrams = append(datagrams, append([]byte(nil), buf.Bytes()...))
+			buf.Reset()
+		}
+		if buf.Len() > 0 {
+			buf.WriteString(separator)
+		}
+		buf.WriteString(line)
+	}
+	if buf.Len() > 0 {
+		datagrams = append(datagrams, buf.Bytes())
+	}
+	return datagrams
+}
+
+// encodePickle encodes the metrics as a list of (path, (timestamp, value)) tuples in pickle protocol 2,
+// prefixed with the length of the payload as carbon expects.
+func encodePickle(metrics []graphiteMetric) [][]byte {
+	var payload bytes.Buffer
+	payload.Write([]byte{0x80, 2}) // PROTO 2
+	payload.WriteByte(']')         // EMPTY_LIST
+	if len(metrics) > 0 {
+		payload.WriteByte('(') // MARK
+		for _, metric := range metrics {
+			payload.WriteByte('X') // BINUNICODE
+			binary.Write(&payload, binary.LittleEndian, uint32(len(metric.path)))
+			payload.WriteString(metric.path)
+			payload.WriteByte('J') // BININT
+			binary.Write(&payload, binary.LittleEndian, int32(metric.timestamp))
+			payload.WriteByte('G') // BINFLOAT
+			binary.Write(&payload, binary.BigEndian, math.Float64bits(metric.value))
+			payload.WriteByte(0x86) // TUPLE2 of timestamp and value
+			payload.WriteByte(0x86) // TUPLE2 of path and datapoint
+		}
+		payload.WriteByte('e') // APPENDS
+	}
+	payload.WriteByte('.') // STOP
+
+	message := make([]byte, 4, 4+payload.Len())
+	binary.BigEndian.PutUint32(message, uint32(payload.Len()))
+	return [][]byte{append(message, payload.Bytes()...)}
+}
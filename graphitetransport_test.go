@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodePlaintextBatchesMetrics(t *testing.T) {
+	payloads := encodePlaintext([]graphiteMetric{{"a.b", 1, 1500000000}, {"c", 0.25, 1500000001}})
+	assert.Equal(t, [][]byte{[]byte("a.b 1 1500000000\nc 0.25 1500000001\n")}, payloads)
+}
+
+func TestEncodePlaintextDatagramsSplitsOnLines(t *testing.T) {
+	var metrics []graphiteMetric
+	for i := 0; i < 100; i++ {
+		metrics = append(metrics, graphiteMetric{"coco.health.test.services.some-service", 1, 1500000000})
+	}
+	datagrams := encodePlaintextDatagrams(metrics)
+	assert.True(t, len(datagrams) > 1)
+	total := 0
+	for _, datagram := range datagrams {
+		assert.True(t, len(datagram) <= maxUDPPayload)
+		assert.True(t, strings.HasSuffix(string(datagram), "\n"))
+		total += strings.Count(string(datagram), "\n")
+	}
+	assert.Equal(t, 100, total)
+}
+
+func TestPackDatagramsSeparatesLines(t *testing.T) {
+	line := strings.Repeat("x", maxUDPPayload/2)
+	datagrams := packDatagrams([]string{"a", "b", line, line}, "\n")
+	assert.Equal(t, [][]byte{[]byte("a\nb\n" + line), []byte(line)}, datagrams)
+}
+
+func TestEncodePickle(t *testing.T) {
+	payloads := encodePickle([]graphiteMetric{{"a.b", 1, 1500000000}, {"c", 0.25, 1500000001}})
+	// pickle.loads gives [('a.b', (1500000000, 1.0)), ('c', (1500000001, 0.25))]
+	assert.Equal(t, "0000003480025d285803000000612e624a002f6859473ff000000000000086865801000000634a012f6859473fd00000000000008686652e", hex.EncodeToString(payloads[0]))
+}
+
+func TestParseGraphiteMetric(t *testing.T) {
+	metric, err := parseGraphiteMetric("a.b 0.25 1500000000")
+	assert.NoError(t, err)
+	assert.Equal(t, graphiteMetric{"a.b", 0.25, 1500000000}, metric)
+
+	_, err = parseGraphiteMetric("a.b 1")
+	assert.Error(t, err)
+}
+
+func TestNewGraphiteTransportRejectsUnknownProtocol(t *testing.T) {
+	_, err := NewGraphiteTransport("carrier-pigeon", "localhost:2003")
+	assert.Error(t, err)
+}
+
+func TestParseGraphiteAddresses(t *testing.T) {
+	addrs, err := parseGraphiteAddresses("graphite.ft.com, graphite-eu.ft.com:2013", 2003)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"graphite.ft.com:2003", "graphite-eu.ft.com:2013"}, addrs)
+
+	_, err = parseGraphiteAddresses(" ", 2003)
+	assert.Error(t, err)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/net/proxy"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const defaultGRPCHealthTimeout = 5 * time.Second
+
+// GRPCHealthChecker checks services through the standard gRPC health checking protocol, grpc.health.v1.Health,
+// connecting through the same dialer as the HTTP checks.
+type GRPCHealthChecker struct {
+	dialer proxy.Dialer
+}
+
+// grpcHealthConfig are the settings of grpc-health checks:
+// address (host:port), grpc_service (the service to check, the whole server if empty) and timeout_seconds.
+type grpcHealthConfig struct {
+	address     string
+	grpcService string
+	timeout     time.Duration
+}
+
+func NewGRPCHealthChecker(dialer proxy.Dialer) *GRPCHealthChecker {
+	return &GRPCHealthChecker{dialer}
+}
+
+func parseGRPCHealthConfig(service Service) (grpcHealthConfig, error) {
+	address, err := service.setting("address")
+	if err != nil {
+		return grpcHealthConfig{}, err
+	}
+	timeout, err := service.settingSeconds("timeout_seconds", defaultGRPCHealthTimeout)
+	if err != nil {
+		return grpcHealthConfig{}, err
+	}
+	return grpcHealthConfig{address: address, grpcService: service.Settings["grpc_service"], timeout: timeout}, nil
+}
+
+func (c *GRPCHealthChecker) Check(service Service) (string, error) {
+	config, err := parseGRPCHealthConfig(service)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), config.timeout)
+	defer cancel()
+
+	dial := func(address string, timeout time.Duration) (net.Conn, error) {
+		return dialWithin(c.dialer, address, timeout)
+	}
+	conn, err := grpc.DialContext(ctx, config.address, grpc.WithInsecure(), grpc.WithBlock(), grpc.WithDialer(dial))
+	if err != nil {
+		return "", fmt.Errorf("Error connecting to %v: %v", config.address, err.Error())
+	}
+	defer conn.Close()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: config.grpcService})
+	if err != nil {
+		return "", fmt.Errorf("Error performing gRPC healthcheck: %v", err.Error())
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		return "", fmt.Errorf("gRPC health status is %v", resp.Status)
+	}
+	return fmt.Sprintf("gRPC health status is %v", resp.Status), nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/proxy"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func startGRPCHealthServer(t *testing.T) (*health.Server, string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	healthServer := health.NewServer()
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	go server.Serve(listener)
+	return healthServer, listener.Addr().String(), server.Stop
+}
+
+func TestGRPCHealthCheckServing(t *testing.T) {
+	healthServer, addr, stop := startGRPCHealthServer(t)
+	defer stop()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+
+	output, err := NewGRPCHealthChecker(proxy.Direct).Check(Service{Name: "foo", CheckType: grpcHealthCheckType, Settings: map[string]string{"address": addr}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "gRPC health status is SERVING", output)
+}
+
+func TestGRPCHealthCheckNotServing(t *testing.T) {
+	healthServer, addr, stop := startGRPCHealthServer(t)
+	defer stop()
+	healthServer.SetServingStatus("foo.Search", healthpb.HealthCheckResponse_NOT_SERVING)
+
+	_, err := NewGRPCHealthChecker(proxy.Direct).Check(Service{Name: "foo", CheckType: grpcHealthCheckType,
+		Settings: map[string]string{"address": addr, "grpc_service": "foo.Search"}})
+
+	assert.EqualError(t, err, "gRPC health status is NOT_SERVING")
+}
+
+func TestGRPCHealthCheckUnknownService(t *testing.T) {
+	_, addr, stop := startGRPCHealthServer(t)
+	defer stop()
+
+	_, err := NewGRPCHealthChecker(proxy.Direct).Check(Service{Name: "foo", CheckType: grpcHealthCheckType,
+		Settings: map[string]string{"address": addr, "grpc_service": "foo.Unknown"}})
+
+	assert.Error(t, err)
+}
+
+func TestGRPCHealthCheckMissingAddress(t *testing.T) {
+	_, err := NewGRPCHealthChecker(proxy.Direct).Check(Service{Name: "foo", ServiceKey: "/ft/healthcheck/foo", CheckType: grpcHealthCheckType})
+
+	assert.EqualError(t, err, "Missing setting /ft/healthcheck/foo/address of grpc-health checks")
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// maxCheckedBodySize is how much of the response body the body assertions look at.
+const maxCheckedBodySize = 1024 * 1024
+
+// PlainHTTPStatusChecker checks services without an FT healthcheck through the status code of an HTTP
+// response, and optionally its body.
+type PlainHTTPStatusChecker struct {
+	client *http.Client
+}
+
+// plainHTTPStatusConfig are the settings of plain-http-status checks: url (the path of the service through
+// vulcand if not set), body_contains and body_regex, along with the request settings of ft-json checks.
+type plainHTTPStatusConfig struct {
+	url          string
+	bodyContains string
+	bodyRegex    *regexp.Regexp
+}
+
+func NewPlainHTTPStatusChecker(client *http.Client) *PlainHTTPStatusChecker {
+	return &PlainHTTPStatusChecker{client: client}
+}
+
+func parsePlainHTTPStatusConfig(service Service) (plainHTTPStatusConfig, error) {
+	config := plainHTTPStatusConfig{
+		url:          service.Settings["url"],
+		bodyContains: service.Settings["body_contains"],
+	}
+	if config.url == "" {
+		config.url = fmt.Sprintf("http://%s%s", service.Host, service.Path)
+	}
+	if expr := service.Settings["body_regex"]; expr != "" {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return plainHTTPStatusConfig{}, fmt.Errorf("Invalid setting %v/body_regex: %v", service.ServiceKey, err.Error())
+		}
+		config.bodyRegex = re
+	}
+	return config, nil
+}
+
+func (c *PlainHTTPStatusChecker) Check(service Service) (string, error) {
+	config, err := parsePlainHTTPStatusConfig(service)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest("GET", config.url, nil)
+	if err != nil {
+		return "", errors.New("Error constructing healthcheck request: " + err.Error())
+	}
+	if service.Settings["url"] == "" {
+		req.Host = service.Name
+	}
+	if service.HostHeader != "" {
+		req.Host = service.HostHeader
+	}
+	for name, value := range service.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := clientFor(c.client, service).Do(req)
+	if err != nil {
+		return "", errors.New("Error performing healthcheck: " + err.Error())
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if !isExpectedPlainStatus(service, resp.StatusCode) {
+		return "", fmt.Errorf("Endpoint returned unexpected status (%v)", resp.Status)
+	}
+	if config.bodyContains == "" && config.bodyRegex == nil {
+		return fmt.Sprintf("Endpoint returned %v", resp.Status), nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxCheckedBodySize))
+	if err != nil {
+		return "", errors.New("Error reading response: " + err.Error())
+	}
+	if config.bodyContains != "" && !strings.Contains(string(body), config.bodyContains) {
+		return "", fmt.Errorf("Response body doesn't contain '%v'", config.bodyContains)
+	}
+	if config.bodyRegex != nil && !config.bodyRegex.Match(body) {
+		return "", fmt.Errorf("Response body doesn't match '%v'", config.bodyRegex)
+	}
+	return fmt.Sprintf("Endpoint returned %v with the expected body", resp.Status), nil
+}
+
+// isExpectedPlainStatus is whether the status is one of the expected ones of the service, any 2xx if none.
+func isExpectedPlainStatus(service Service, status int) bool {
+	if len(service.ExpectedStatuses) == 0 {
+		return status >= 200 && status <= 299
+	}
+	return isExpectedStatus(service, status)
+}
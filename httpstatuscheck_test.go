@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlainHTTPStatusCheck(t *testing.T) {
+	var host string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	checker := NewPlainHTTPStatusChecker(http.DefaultClient)
+	service := Service{Name: "queue", Host: strings.TrimPrefix(server.URL, "http://"), Path: "/health/queue/status", CheckType: plainHTTPStatusCheckType}
+
+	output, err := checker.Check(service)
+	assert.NoError(t, err)
+	assert.Equal(t, "Endpoint returned 204 No Content", output)
+	assert.Equal(t, "queue", host)
+
+	service.ExpectedStatuses = []int{200}
+	_, err = checker.Check(service)
+	assert.EqualError(t, err, "Endpoint returned unexpected status (204 No Content)")
+}
+
+func TestPlainHTTPStatusCheckBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("status: green, nodes: 3"))
+	}))
+	defer server.Close()
+	checker := NewPlainHTTPStatusChecker(http.DefaultClient)
+	service := Service{Name: "search", CheckType: plainHTTPStatusCheckType, Settings: map[string]string{"url": server.URL, "body_contains": "green", "body_regex": "nodes: [3-9]"}}
+
+	output, err := checker.Check(service)
+	assert.NoError(t, err)
+	assert.Equal(t, "Endpoint returned 200 OK with the expected body", output)
+
+	service.Settings["body_contains"] = "red"
+	_, err = checker.Check(service)
+	assert.EqualError(t, err, "Response body doesn't contain 'red'")
+
+	service.Settings["body_contains"] = ""
+	service.Settings["body_regex"] = "nodes: [4-9]"
+	_, err = checker.Check(service)
+	assert.EqualError(t, err, "Response body doesn't match 'nodes: [4-9]'")
+}
+
+func TestPlainHTTPStatusCheckInvalidRegex(t *testing.T) {
+	service := Service{Name: "search", ServiceKey: "/ft/healthcheck/search", CheckType: plainHTTPStatusCheckType, Settings: map[string]string{"body_regex": "("}}
+
+	_, err := NewPlainHTTPStatusChecker(http.DefaultClient).Check(service)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid setting /ft/healthcheck/search/body_regex")
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultIncidentEventsURL = "https://events.pagerduty.com/v2/enqueue"
+	triggerAction            = "trigger"
+	resolveAction            = "resolve"
+)
+
+type incidentEvent struct {
+	RoutingKey  string           `json:"routing_key"`
+	EventAction string           `json:"event_action"`
+	DedupKey    string           `json:"dedup_key"`
+	Payload     *incidentPayload `json:"payload,omitempty"`
+	Links       []incidentLink   `json:"links,omitempty"`
+}
+
+type incidentPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     string            `json:"timestamp,omitempty"`
+	Component     string            `json:"component,omitempty"`
+	Group         string            `json:"group,omitempty"`
+	Class         string            `json:"class,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+type incidentLink struct {
+	Href string `json:"href"`
+	Text string `json:"text"`
+}
+
+// IncidentSink opens, updates and resolves incidents through a PagerDuty-style Events v2 API when a
+// severity 1 service or a whole category becomes unhealthy, or when a service gets escalated. No incident
+// gets opened or updated while the service or the cluster is acked; the incidents still unhealthy get
+// re-triggered once the ack is removed.
+type IncidentSink struct {
+	url        string
+	routingKey string
+	client     *http.Client
+	// unhealthy services and categories by dedup key, and the ones with an open incident, only accessed by
+	// the delivery goroutine
+	problems  map[string]Notification
+	triggered map[string]bool
+}
+
+func NewIncidentSink(url string, routingKey string, client *http.Client) *IncidentSink {
+	return &IncidentSink{url, routingKey, client, make(map[string]Notification), make(map[string]bool)}
+}
+
+func (s *IncidentSink) Name() string {
+	return "incidents"
+}
+
+func (s *IncidentSink) Send(n Notification) error {
+	switch n.Event {
+	case serviceStateChanged:
+		if _, open := s.problems[serviceDedupKey(n)]; !open && n.Severity != 1 {
+			return nil
+		}
+		return s.stateChanged(serviceDedupKey(n), n)
+	case serviceEscalated:
+		return s.stateChanged(serviceDedupKey(n), n)
+	case categoryStateChanged, categoryEscalated:
+		return s.stateChanged(categoryDedupKey(n), n)
+	case serviceAcked:
+		if problem, found := s.problems[serviceDedupKey(n)]; found {
+			problem.Ack = n.Ack
+			s.problems[serviceDedupKey(n)] = problem
+		}
+	case serviceAckRemoved:
+		if problem, found := s.problems[serviceDedupKey(n)]; found {
+			problem.Ack = ""
+			problem.ClusterAck = n.ClusterAck
+			s.problems[serviceDedupKey(n)] = problem
+			return s.trigger(serviceDedupKey(n), problem)
+		}
+	case clusterAckRemoved:
+		for dedupKey, problem := range s.problems {
+			problem.ClusterAck = ""
+			s.problems[dedupKey] = problem
+			if err := s.trigger(dedupKey, problem); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *IncidentSink) stateChanged(dedupKey string, n Notification) error {
+	if n.Ok {
+		delete(s.problems, dedupKey)
+		if !s.triggered[dedupKey] {
+			return nil
+		}
+		delete(s.triggered, dedupKey)
+		return s.send(incidentEvent{RoutingKey: s.routingKey, EventAction: resolveAction, DedupKey: dedupKey})
+	}
+	s.problems[dedupKey] = n
+	return s.trigger(dedupKey, n)
+}
+
+func (s *IncidentSink) trigger(dedupKey string, n Notification) error {
+	if n.Ack != "" || n.ClusterAck != "" {
+		infoLogger.Printf("Not triggering incident %v as it is acked.", dedupKey)
+		return nil
+	}
+
+	event := incidentEvent{
+		RoutingKey:  s.routingKey,
+		EventAction: triggerAction,
+		DedupKey:    dedupKey,
+		Payload: &incidentPayload{
+			Summary:   n.summary(),
+			Source:    n.Environment,
+			Severity:  severityName(n.Severity),
+			Timestamp: n.Time.Format(time.RFC3339),
+			Component: n.Service,
+			Group:     n.Category,
+			Class:     n.Event,
+			CustomDetails: map[string]string{
+				"output": n.Output,
+			},
+		},
+	}
+	if n.Team != "" {
+		event.Payload.CustomDetails["team"] = n.Team
+	}
+	if n.SystemCode != "" {
+		event.Payload.CustomDetails["systemCode"] = n.SystemCode
+	}
+	if len(n.FailingChecks) > 0 {
+		event.Payload.CustomDetails["failingChecks"] = n.failingChecksSummary()
+	}
+	if n.PanicGuide != "" {
+		event.Links = []incidentLink{{n.PanicGuide, "Panic guide"}}
+	}
+	if err := s.send(event); err != nil {
+		return err
+	}
+	s.triggered[dedupKey] = true
+	return nil
+}
+
+func (s *IncidentSink) send(event incidentEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return errors.New("Error encoding incident event: " + err.Error())
+	}
+	return postJSON(s.client, s.url, body)
+}
+
+func serviceDedupKey(n Notification) string {
+	return fmt.Sprintf("%s/service/%s", n.Environment, n.Service)
+}
+
+func categoryDedupKey(n Notification) string {
+	return fmt.Sprintf("%s/category/%s", n.Environment, n.Category)
+}
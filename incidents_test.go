@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newIncidentStandIn(t *testing.T) (*httptest.Server, *[]incidentEvent) {
+	var events []incidentEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event incidentEvent
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		events = append(events, event)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	return server, &events
+}
+
+func newIncidentTestSink(url string) *IncidentSink {
+	return NewIncidentSink(url, "routing-key", http.DefaultClient)
+}
+
+func TestIncidentSinkTriggersAndResolvesHighSeverityServices(t *testing.T) {
+	server, events := newIncidentStandIn(t)
+	defer server.Close()
+	sink := newIncidentTestSink(server.URL)
+
+	assert.NoError(t, sink.Send(Notification{Event: serviceStateChanged, Environment: "prod-uk", Service: "document-store-api-1", Severity: 2}))
+	assert.Len(t, *events, 0, "low severity services don't raise incidents")
+
+	assert.NoError(t, sink.Send(Notification{Event: serviceStateChanged, Environment: "prod-uk", Service: "publish-availability-monitor-1", Severity: 1, Output: "publish failed"}))
+	assert.NoError(t, sink.Send(Notification{Event: serviceStateChanged, Environment: "prod-uk", Service: "publish-availability-monitor-1", Severity: 1, Ok: true}))
+
+	assert.Len(t, *events, 2)
+	trigger := (*events)[0]
+	assert.Equal(t, "routing-key", trigger.RoutingKey)
+	assert.Equal(t, triggerAction, trigger.EventAction)
+	assert.Equal(t, "prod-uk/service/publish-availability-monitor-1", trigger.DedupKey)
+	assert.Equal(t, "critical", trigger.Payload.Severity)
+	assert.Equal(t, "publish failed", trigger.Payload.CustomDetails["output"])
+	resolve := (*events)[1]
+	assert.Equal(t, resolveAction, resolve.EventAction)
+	assert.Equal(t, trigger.DedupKey, resolve.DedupKey)
+}
+
+func TestIncidentSinkResolvesOnlyTriggeredIncidents(t *testing.T) {
+	server, events := newIncidentStandIn(t)
+	defer server.Close()
+	sink := newIncidentTestSink(server.URL)
+
+	assert.NoError(t, sink.Send(Notification{Event: serviceStateChanged, Environment: "prod-uk", Service: "publish-availability-monitor-1", Severity: 1, Ok: true, Slow: true}))
+	assert.NoError(t, sink.Send(Notification{Event: serviceStateChanged, Environment: "prod-uk", Service: "publish-availability-monitor-1", Severity: 1, Ok: true}))
+	assert.Len(t, *events, 0, "getting slow and fast again doesn't resolve any incident")
+
+	assert.NoError(t, sink.Send(Notification{Event: serviceStateChanged, Environment: "prod-uk", Service: "publish-availability-monitor-1", Severity: 1, Ack: "known issue"}))
+	assert.NoError(t, sink.Send(Notification{Event: serviceStateChanged, Environment: "prod-uk", Service: "publish-availability-monitor-1", Severity: 1, Ok: true}))
+	assert.Len(t, *events, 0, "acked problems have no incident to resolve")
+}
+
+func TestIncidentSinkTriggersUnhealthyCategories(t *testing.T) {
+	server, events := newIncidentStandIn(t)
+	defer server.Close()
+	sink := newIncidentTestSink(server.URL)
+
+	assert.NoError(t, sink.Send(Notification{Event: categoryStateChanged, Environment: "prod-uk", Category: "read", Categories: []string{"read"}, Severity: 2}))
+
+	assert.Len(t, *events, 1)
+	assert.Equal(t, triggerAction, (*events)[0].EventAction)
+	assert.Equal(t, "prod-uk/category/read", (*events)[0].DedupKey)
+	assert.Equal(t, "warning", (*events)[0].Payload.Severity)
+}
+
+func TestIncidentSinkSuppressesAckedProblems(t *testing.T) {
+	server, events := newIncidentStandIn(t)
+	defer server.Close()
+	sink := newIncidentTestSink(server.URL)
+
+	assert.NoError(t, sink.Send(Notification{Event: serviceStateChanged, Environment: "prod-uk", Service: "publish-availability-monitor-1", Severity: 1, Ack: "known issue"}))
+	assert.NoError(t, sink.Send(Notification{Event: categoryStateChanged, Environment: "prod-uk", Category: "read", Severity: 2, ClusterAck: "maintenance"}))
+	assert.Len(t, *events, 0, "acked problems don't raise incidents")
+
+	assert.NoError(t, sink.Send(Notification{Event: clusterAckRemoved, Environment: "prod-uk"}))
+	assert.Len(t, *events, 1, "only the category is re-triggered once the cluster ack is removed")
+	assert.Equal(t, "prod-uk/category/read", (*events)[0].DedupKey)
+
+	assert.NoError(t, sink.Send(Notification{Event: serviceAckRemoved, Environment: "prod-uk", Service: "publish-availability-monitor-1"}))
+	assert.Len(t, *events, 2)
+	assert.Equal(t, "prod-uk/service/publish-availability-monitor-1", (*events)[1].DedupKey)
+	assert.Equal(t, triggerAction, (*events)[1].EventAction)
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const (
+	influxMeasurement      = "service_health"
+	maxPendingInfluxPoints = 100000
+)
+
+// InfluxTransport writes batches of points in the InfluxDB line protocol.
+type InfluxTransport interface {
+	sinkConnection
+	write(lines []string) error
+}
+
+// NewInfluxTransport picks the transport from the scheme of the url: http(s)://host:8086 writes to the
+// database over HTTP, udp://host:8089 sends datagrams to the UDP listener, which has its own database.
+func NewInfluxTransport(rawURL string, database string, client *http.Client) (InfluxTransport, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid InfluxDB url '%v': %v", rawURL, err.Error())
+	}
+	switch u.Scheme {
+	case "http", "https":
+		if database == "" {
+			return nil, errors.New("No InfluxDB database configured")
+		}
+		return &influxHTTPTransport{url: strings.TrimRight(rawURL, "/"), database: database, client: client}, nil
+	case "udp":
+		return &influxUDPTransport{addr: u.Host}, nil
+	}
+	return nil, fmt.Errorf("Unknown InfluxDB url scheme '%v', expecting http, https or udp", u.Scheme)
+}
+
+// influxRejectedError is returned when InfluxDB rejects a batch, e.g. for a malformed point or a missing
+// database. Sending it again would fail the same way, so it isn't retried.
+type influxRejectedError struct {
+	status string
+}
+
+func (e *influxRejectedError) Error() string {
+	return fmt.Sprintf("InfluxDB rejected the points (%v)", e.status)
+}
+
+type influxHTTPTransport struct {
+	url       string
+	database  string
+	client    *http.Client
+	connected bool
+}
+
+// connect pings the InfluxDB server, as there is no connection to keep over HTTP.
+func (t *influxHTTPTransport) connect() error {
+	t.connected = false
+	resp, err := t.client.Get(t.url + "/ping")
+	if err != nil {
+		return fmt.Errorf("Error while pinging InfluxDB [%v]", err.Error())
+	}
+	defer discardBody(resp)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("InfluxDB ping returned non-2xx status (%v)", resp.Status)
+	}
+	t.connected = true
+	return nil
+}
+
+func (t *influxHTTPTransport) write(lines []string) error {
+	if !t.connected {
+		return errors.New("Can't send results, InfluxDB is not reachable.")
+	}
+	writeURL := fmt.Sprintf("%v/write?db=%v&precision=s", t.url, url.QueryEscape(t.database))
+	resp, err := t.client.Post(writeURL, "text/plain", strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		t.connected = false
+		return fmt.Errorf("Error sending results to InfluxDB: [%v]", err.Error())
+	}
+	defer discardBody(resp)
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("InfluxDB write returned non-2xx status (%v)", resp.Status)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &influxRejectedError{resp.Status}
+	}
+	return nil
+}
+
+func (t *influxHTTPTransport) isConnected() bool {
+	return t.connected
+}
+
+func (t *influxHTTPTransport) address() string {
+	return t.url
+}
+
+func discardBody(resp *http.Response) {
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+type influxUDPTransport struct {
+	addr string
+	conn net.Conn
+}
+
+func (t *influxUDPTransport) connect() error {
+	if t.conn != nil {
+		t.conn.Close()
+		t.conn = nil
+	}
+	conn, err := net.Dial("udp", t.addr)
+	if err != nil {
+		return fmt.Errorf("Error while creating UDP connection [%v]", err)
+	}
+	t.conn = conn
+	return nil
+}
+
+// write sends the points to InfluxDB, packed into as few datagrams as possible.
+func (t *influxUDPTransport) write(lines []string) error {
+	if t.conn == nil {
+		return errors.New("Can't send results, no InfluxDB connection.")
+	}
+	for _, datagram := range packDatagrams(lines, "\n") {
+		if _, err := t.conn.Write(datagram); err != nil {
+			return fmt.Errorf("Error sending results to InfluxDB: [%v]", err.Error())
+		}
+	}
+	return nil
+}
+
+func (t *influxUDPTransport) isConnected() bool {
+	return t.conn != nil
+}
+
+func (t *influxUDPTransport) address() string {
+	return t.addr
+}
+
+// InfluxSink sends the health of every service check to InfluxDB as points in the line protocol. The points
+// it fails to send are kept in memory and sent again after reconnecting, unless InfluxDB rejected them.
+type InfluxSink struct {
+	transport   InfluxTransport
+	environment string
+	batchSize   int
+	pending     []string
+}
+
+func NewInfluxSink(transport InfluxTransport, environment string, batchSize int) *InfluxSink {
+	s := &InfluxSink{transport: transport, environment: environment, batchSize: batchSize}
+	connectSink(s.Name(), transport)
+	return s
+}
+
+func (s *InfluxSink) Name() string {
+	return "influxdb " + s.transport.address()
+}
+
+func (s *InfluxSink) Send(snapshot HealthSnapshot) error {
+	lines := s.pending
+	for _, result := range snapshot.Results {
+		lines = append(lines, influxLine(s.environment, result.Service, result.Health))
+	}
+	s.pending = nil
+	sent, err := sendInBatches(len(lines), s.batchSize, func(from, to int) error {
+		err := s.transport.write(lines[from:to])
+		if rejected, ok := err.(*influxRejectedError); ok {
+			warnLogger.Printf("Dropping %v points: %v", to-from, rejected.Error())
+			selfMetrics.sinkDrops.add(s.Name(), float64(to-from))
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		s.pending = lines[sent:]
+		if excess := excessPending(s.Name(), len(s.pending), maxPendingInfluxPoints); excess > 0 {
+			s.pending = append([]string(nil), s.pending[excess:]...)
+		}
+		selfMetrics.sinkFailures.inc(s.Name())
+		reconnectSink(s.Name(), s.transport)
+	}
+	selfHealth.sinkBacklog(s.Name(), len(s.pending), maxPendingInfluxPoints)
+	return err
+}
+
+// influxLine is the point of a single check of the service, tagged with the environment, the service, its
+// group and its categories, e.g.
+// service_health,categories=default\,read,environment=prod,service=foo-service-1,service_group=foo-service ok=false,latency=0.25,severity=1i,acked=true 1500000000
+func influxLine(environment string, service Service, result MeasuredHealth) string {
+	check := result.Checks[0]
+	group, _ := splitServiceInstance(service.Name)
+	categories := append([]string(nil), service.Categories...)
+	if len(categories) == 0 {
+		categories = []string{defaultCategoryName}
+	}
+	sort.Strings(categories)
+
+	// tags sorted by key, as InfluxDB recommends
+	tags := []struct {
+		key   string
+		value string
+	}{
+		{"categories", strings.Join(categories, ",")},
+		{"environment", environment},
+		{"service", service.Name},
+		{"service_group", group},
+	}
+	var buf bytes.Buffer
+	buf.WriteString(influxMeasurement)
+	for _, tag := range tags {
+		if tag.value == "" {
+			continue
+		}
+		fmt.Fprintf(&buf, ",%s=%s", tag.key, escapeInfluxTag(tag.value))
+	}
+	fmt.Fprintf(&buf, " ok=%t,latency=%s,severity=%di,acked=%t %d",
+		check.Ok, formatValue(result.Latency.Seconds()), check.Severity, check.Ack != "", check.LastUpdated.Unix())
+	return buf.String()
+}
+
+// escapeInfluxTag escapes the characters separating tags and fields in the line protocol.
+func escapeInfluxTag(value string) string {
+	return influxTagReplacer.Replace(value)
+}
+
+var influxTagReplacer = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	fthealth "github.com/Financial-Times/go-fthealth/v1a"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockInfluxTransport struct {
+	written   []string
+	connected bool
+	rejected  bool
+}
+
+func (t *MockInfluxTransport) connect() error {
+	return nil
+}
+
+func (t *MockInfluxTransport) write(lines []string) error {
+	if !t.connected {
+		return errors.New("InfluxDB is not reachable")
+	}
+	if t.rejected {
+		return &influxRejectedError{"400 Bad Request"}
+	}
+	t.written = append(t.written, lines...)
+	return nil
+}
+
+func (t *MockInfluxTransport) isConnected() bool {
+	return t.connected
+}
+
+func (t *MockInfluxTransport) address() string {
+	return "http://influxdb:8086"
+}
+
+func TestInfluxLine(t *testing.T) {
+	line := influxLine("prod uk", Service{Name: "foo-service-1", Categories: []string{"read", "default"}}, MeasuredHealth{
+		HealthResult: fthealth.HealthResult{Checks: []fthealth.CheckResult{{Name: "foo-service-1", Ok: false, Severity: 1, Ack: "on it", LastUpdated: time.Unix(1500000000, 0)}}},
+		Latency:      250 * time.Millisecond,
+	})
+
+	assert.Equal(t, `service_health,categories=default\,read,environment=prod\ uk,service=foo-service-1,service_group=foo-service ok=false,latency=0.25,severity=1i,acked=true 1500000000`, line)
+}
+
+func TestInfluxLineDefaultCategory(t *testing.T) {
+	line := influxLine("", Service{Name: "bar=service"}, MeasuredHealth{
+		HealthResult: fthealth.HealthResult{Checks: []fthealth.CheckResult{{Name: "bar=service", Ok: true, Severity: 2, LastUpdated: time.Unix(1500000000, 0)}}},
+		Latency:      time.Second,
+	})
+
+	assert.Equal(t, `service_health,categories=default,service=bar\=service,service_group=bar\=service ok=true,latency=1,severity=2i,acked=false 1500000000`, line)
+}
+
+func TestInfluxSinkKeepsPointsUntilReconnected(t *testing.T) {
+	transport := &MockInfluxTransport{}
+	sink := NewInfluxSink(transport, "test", 2)
+	snapshot := func(name string) HealthSnapshot {
+		return HealthSnapshot{Results: []ServiceResult{{Service{Name: name}, MeasuredHealth{
+			HealthResult: fthealth.HealthResult{Checks: []fthealth.CheckResult{{Name: name, Ok: true, LastUpdated: time.Unix(1500000000, 0)}}},
+			Latency:      time.Second,
+		}}}}
+	}
+
+	assert.Error(t, sink.Send(snapshot("foo")))
+	assert.Empty(t, transport.written)
+	assert.Len(t, sink.pending, 1)
+
+	transport.connected = true
+	assert.NoError(t, sink.Send(snapshot("bar")))
+	assert.Len(t, transport.written, 2)
+	assert.Contains(t, transport.written[0], "service=foo")
+	assert.Contains(t, transport.written[1], "service=bar")
+	assert.Empty(t, sink.pending)
+}
+
+func TestInfluxSinkDropsRejectedPoints(t *testing.T) {
+	transport := &MockInfluxTransport{connected: true, rejected: true}
+	sink := NewInfluxSink(transport, "test", 2)
+	snapshot := HealthSnapshot{Results: []ServiceResult{{Service{Name: "foo"}, MeasuredHealth{
+		HealthResult: fthealth.HealthResult{Checks: []fthealth.CheckResult{{Name: "foo", Ok: true, LastUpdated: time.Unix(1500000000, 0)}}},
+	}}}}
+
+	assert.NoError(t, sink.Send(snapshot))
+	assert.Empty(t, transport.written)
+	assert.Empty(t, sink.pending, "rejected points shouldn't be retried")
+}
+
+func TestInfluxHTTPTransportWrite(t *testing.T) {
+	status := http.StatusNoContent
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/write" {
+			b, _ := ioutil.ReadAll(r.Body)
+			body = string(b)
+			assert.Equal(t, "health", r.URL.Query().Get("db"))
+			w.WriteHeader(status)
+		}
+	}))
+	defer server.Close()
+	transport, err := NewInfluxTransport(server.URL, "health", http.DefaultClient)
+	assert.NoError(t, err)
+	assert.NoError(t, transport.connect())
+
+	assert.NoError(t, transport.write([]string{"a", "b"}))
+	assert.Equal(t, "a\nb", body)
+
+	status = http.StatusBadRequest
+	err = transport.write([]string{"a"})
+	assert.IsType(t, &influxRejectedError{}, err)
+
+	status = http.StatusServiceUnavailable
+	err = transport.write([]string{"a"})
+	assert.Error(t, err)
+	_, rejected := err.(*influxRejectedError)
+	assert.False(t, rejected, "server errors should be retried")
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+var defaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// counter counts events, optionally by the value of a single label.
+type counter struct {
+	sync.Mutex
+	values map[string]float64
+}
+
+func newCounter() *counter {
+	return &counter{values: make(map[string]float64)}
+}
+
+func (c *counter) inc(labelValue string) {
+	c.add(labelValue, 1)
+}
+
+func (c *counter) add(labelValue string, delta float64) {
+	c.Lock()
+	defer c.Unlock()
+	c.values[labelValue] += delta
+}
+
+func (c *counter) total() float64 {
+	c.Lock()
+	defer c.Unlock()
+	var total float64
+	for _, value := range c.values {
+		total += value
+	}
+	return total
+}
+
+func (c *counter) family(name string, help string, labelName string) *metricFamily {
+	c.Lock()
+	defer c.Unlock()
+	family := newMetricFamily(name, counterType, help)
+	for _, labelValue := range sortedKeys(c.values) {
+		if labelName == "" {
+			family.add(c.values[labelValue])
+		} else {
+			family.add(c.values[labelValue], metricLabel{labelName, labelValue})
+		}
+	}
+	return family
+}
+
+// gauge holds values that can go up and down, optionally by the value of a single label.
+type gauge struct {
+	sync.Mutex
+	values map[string]float64
+}
+
+func newGauge() *gauge {
+	return &gauge{values: make(map[string]float64)}
+}
+
+func (g *gauge) set(labelValue string, value float64) {
+	g.Lock()
+	defer g.Unlock()
+	g.values[labelValue] = value
+}
+
+func (g *gauge) family(name string, help string, labelName string) *metricFamily {
+	g.Lock()
+	defer g.Unlock()
+	family := newMetricFamily(name, gaugeType, help)
+	for _, labelValue := range sortedKeys(g.values) {
+		if labelName == "" {
+			family.add(g.values[labelValue])
+		} else {
+			family.add(g.values[labelValue], metricLabel{labelName, labelValue})
+		}
+	}
+	return family
+}
+
+type histogramSeries struct {
+	counts []float64
+	sum    float64
+	count  float64
+}
+
+// histogram observes durations in seconds, optionally by the value of a single label.
+type histogram struct {
+	sync.Mutex
+	buckets []float64
+	series  map[string]*histogramSeries
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, series: make(map[string]*histogramSeries)}
+}
+
+func (h *histogram) observe(labelValue string, seconds float64) {
+	h.Lock()
+	defer h.Unlock()
+	series, found := h.series[labelValue]
+	if !found {
+		series = &histogramSeries{counts: make([]float64, len(h.buckets))}
+		h.series[labelValue] = series
+	}
+	for i, bound := range h.buckets {
+		if seconds <= bound {
+			series.counts[i]++
+		}
+	}
+	series.sum += seconds
+	series.count++
+}
+
+func (h *histogram) family(name string, help string, labelName string) *metricFamily {
+	h.Lock()
+	defer h.Unlock()
+	family := newMetricFamily(name, histogramType, help)
+	labelValues := make([]string, 0, len(h.series))
+	for labelValue := range h.series {
+		labelValues = append(labelValues, labelValue)
+	}
+	sort.Strings(labelValues)
+	for _, labelValue := range labelValues {
+		series := h.series[labelValue]
+		var labels []metricLabel
+		if labelName != "" {
+			labels = append(labels, metricLabel{labelName, labelValue})
+		}
+		for i, bound := range h.buckets {
+			family.addSuffixed("_bucket", series.counts[i], append(labels, metricLabel{"le", formatValue(bound)})...)
+		}
+		family.addSuffixed("_bucket", series.count, append(labels, metricLabel{"le", "+Inf"})...)
+		family.addSuffixed("_sum", series.sum, labels...)
+		family.addSuffixed("_count", series.count, labels...)
+	}
+	return family
+}
+
+// AggregatorMetrics instruments the aggregator itself.
+type AggregatorMetrics struct {
+	checksExecuted  *counter
+	checkDuration   *histogram
+	bufferDrops     *counter
+	sinkFailures    *counter
+	sinkReconnects  *counter
+	spoolBytes      *gauge
+	spoolDrops      *counter
+	sinkDrops       *counter
+	etcdReloads     *counter
+	etcdErrors      *counter
+	handlerDuration *histogram
+}
+
+func NewAggregatorMetrics() *AggregatorMetrics {
+	return &AggregatorMetrics{
+		checksExecuted:  newCounter(),
+		checkDuration:   newHistogram(defaultDurationBuckets),
+		bufferDrops:     newCounter(),
+		sinkFailures:    newCounter(),
+		sinkReconnects:  newCounter(),
+		spoolBytes:      newGauge(),
+		spoolDrops:      newCounter(),
+		sinkDrops:       newCounter(),
+		etcdReloads:     newCounter(),
+		etcdErrors:      newCounter(),
+		handlerDuration: newHistogram(defaultDurationBuckets),
+	}
+}
+
+var selfMetrics = NewAggregatorMetrics()
+
+func (m *AggregatorMetrics) families() []*metricFamily {
+	return []*metricFamily{
+		m.checksExecuted.family("aggregate_health_checks_executed_total", "Number of service checks executed.", ""),
+		m.checkDuration.family("aggregate_health_check_duration_seconds", "Duration of the scheduled service checks.", ""),
+		m.bufferDrops.family("aggregate_health_buffer_drops_total", "Number of health measurements dropped because the Graphite buffer of the service was full.", ""),
+		m.sinkFailures.family("aggregate_health_metrics_sink_send_failures_total", "Number of failed attempts to send metrics to a backend, like Graphite.", "sink"),
+		m.sinkReconnects.family("aggregate_health_metrics_sink_reconnects_total", "Number of reconnections to a metrics backend.", "sink"),
+		m.spoolBytes.family("aggregate_health_graphite_spool_bytes", "Size of the metrics spooled on disk while Graphite is unavailable.", "path"),
+		m.spoolDrops.family("aggregate_health_graphite_spool_drops_total", "Number of metric lines dropped because the Graphite spool was full.", "path"),
+		m.sinkDrops.family("aggregate_health_metrics_sink_drops_total", "Number of snapshots or metrics dropped because a metrics sink couldn't keep up.", "sink"),
+		m.etcdReloads.family("aggregate_health_etcd_reloads_total", "Number of reloads of the configuration from etcd.", "target"),
+		m.etcdErrors.family("aggregate_health_etcd_errors_total", "Number of errors reading or watching etcd.", "target"),
+		m.handlerDuration.family("aggregate_health_http_request_duration_seconds", "Duration of the HTTP requests served.", "handler"),
+	}
+}
+
+// summary describes the state of the aggregator in a single line.
+func (m *AggregatorMetrics) summary() string {
+	return fmt.Sprintf("Aggregator: %.0f checks executed, %.0f measurements dropped, %.0f metrics send failures, %.0f metrics backend reconnects, %.0f etcd reloads, %.0f etcd errors.",
+		m.checksExecuted.total(), m.bufferDrops.total(), m.sinkFailures.total(), m.sinkReconnects.total(), m.etcdReloads.total(), m.etcdErrors.total())
+}
+
+// instrumented records the duration of every request served by the handler.
+func instrumented(name string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		handler(w, r)
+		selfMetrics.handlerDuration.observe(name, time.Since(start).Seconds())
+	}
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogramFamily(t *testing.T) {
+	h := newHistogram([]float64{0.1, 1})
+	h.observe("/__health", 0.05)
+	h.observe("/__health", 0.5)
+	h.observe("/__health", 2)
+
+	var buf bytes.Buffer
+	h.family("request_duration_seconds", "Duration.", "handler").writeTo(&buf)
+
+	body := buf.String()
+	assert.Contains(t, body, "# TYPE request_duration_seconds histogram\n")
+	assert.Contains(t, body, `request_duration_seconds_bucket{handler="/__health",le="0.1"} 1`+"\n")
+	assert.Contains(t, body, `request_duration_seconds_bucket{handler="/__health",le="1"} 2`+"\n")
+	assert.Contains(t, body, `request_duration_seconds_bucket{handler="/__health",le="+Inf"} 3`+"\n")
+	assert.Contains(t, body, `request_duration_seconds_sum{handler="/__health"} 2.55`+"\n")
+	assert.Contains(t, body, `request_duration_seconds_count{handler="/__health"} 3`+"\n")
+}
+
+func TestCounterFamily(t *testing.T) {
+	c := newCounter()
+	c.inc("services")
+	c.inc("services")
+	c.add("categories", 3)
+
+	var buf bytes.Buffer
+	c.family("etcd_reloads_total", "Reloads.", "target").writeTo(&buf)
+
+	assert.Equal(t, float64(5), c.total())
+	assert.Equal(t, "# HELP etcd_reloads_total Reloads.\n# TYPE etcd_reloads_total counter\n"+
+		`etcd_reloads_total{target="categories"} 3`+"\n"+
+		`etcd_reloads_total{target="services"} 2`+"\n", buf.String())
+}
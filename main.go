@@ -3,7 +3,9 @@ package main
 import (
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/smtp"
 	"os"
 	"strings"
 	"time"
@@ -43,15 +45,147 @@ func main() {
 	graphiteHost := app.String(cli.StringOpt{
 		Name:   "graphite-host",
 		Value:  "graphite.ft.com",
-		Desc:   "Graphite host address",
+		Desc:   "Comma-separated list of Graphite hosts to send the same metrics to, as host or host:port",
 		EnvVar: "GRAPHITE_HOST",
 	})
 	graphitePort := app.Int(cli.IntOpt{
 		Name:   "graphite-port",
 		Value:  2003,
-		Desc:   "Graphite port",
+		Desc:   "Graphite port, for the hosts not specifying it",
 		EnvVar: "GRAPHITE_PORT",
 	})
+	graphitePrefix := app.String(cli.StringOpt{
+		Name:   "graphite-prefix",
+		Value:  defaultGraphitePrefix,
+		Desc:   "Prefix of the Graphite metric names, available as {{.Prefix}} in the naming templates",
+		EnvVar: "GRAPHITE_PREFIX",
+	})
+	graphitePilotTemplate := app.String(cli.StringOpt{
+		Name:   "graphite-pilot-template",
+		Value:  defaultGraphitePilotTemplate,
+		Desc:   "Template of the Graphite pilot light metric name, using {{.Prefix}} and {{.Environment}}",
+		EnvVar: "GRAPHITE_PILOT_TEMPLATE",
+	})
+	graphiteServiceTemplate := app.String(cli.StringOpt{
+		Name:   "graphite-service-template",
+		Value:  defaultGraphiteServiceTemplate,
+		Desc:   "Template of the Graphite service metric names, using {{.Prefix}}, {{.Environment}}, {{.Category}}, {{.Service}}, {{.ServiceGroup}} and {{.Instance}}",
+		EnvVar: "GRAPHITE_SERVICE_TEMPLATE",
+	})
+	graphiteServiceSeriesTemplate := app.String(cli.StringOpt{
+		Name:   "graphite-service-series-template",
+		Value:  defaultGraphiteServiceSeriesTemplate,
+		Desc:   "Template of the Graphite names of the latency, severity and acked series of services, using the fields of the service template and {{.Metric}}",
+		EnvVar: "GRAPHITE_SERVICE_SERIES_TEMPLATE",
+	})
+	graphiteCategoryTemplate := app.String(cli.StringOpt{
+		Name:   "graphite-category-template",
+		Value:  defaultGraphiteCategoryTemplate,
+		Desc:   "Template of the Graphite category health metric names, using {{.Prefix}}, {{.Environment}} and {{.Category}}",
+		EnvVar: "GRAPHITE_CATEGORY_TEMPLATE",
+	})
+	graphiteClusterTemplate := app.String(cli.StringOpt{
+		Name:   "graphite-cluster-template",
+		Value:  defaultGraphiteClusterTemplate,
+		Desc:   "Template of the Graphite cluster health metric name, using {{.Prefix}} and {{.Environment}}",
+		EnvVar: "GRAPHITE_CLUSTER_TEMPLATE",
+	})
+	graphiteProtocol := app.String(cli.StringOpt{
+		Name:   "graphite-protocol",
+		Value:  plaintextTCPProtocol,
+		Desc:   "Protocol to send metrics to Graphite with: plaintext-tcp, plaintext-udp or pickle",
+		EnvVar: "GRAPHITE_PROTOCOL",
+	})
+	graphiteBatchSize := app.Int(cli.IntOpt{
+		Name:   "graphite-batch-size",
+		Value:  500,
+		Desc:   "Maximum number of metrics sent to Graphite in one write",
+		EnvVar: "GRAPHITE_BATCH_SIZE",
+	})
+	graphiteSpoolPath := app.String(cli.StringOpt{
+		Name:   "graphite-spool-path",
+		Value:  "",
+		Desc:   "File to spool metrics to while Graphite is unavailable, to be replayed once it is back; metrics are only spooled if set",
+		EnvVar: "GRAPHITE_SPOOL_PATH",
+	})
+	graphiteSpoolMaxMB := app.Int(cli.IntOpt{
+		Name:   "graphite-spool-max-mb",
+		Value:  100,
+		Desc:   "Maximum size in megabytes of the Graphite spool, metrics being dropped once it is full",
+		EnvVar: "GRAPHITE_SPOOL_MAX_MB",
+	})
+	metricsFile := app.String(cli.StringOpt{
+		Name:   "metrics-file",
+		Value:  "",
+		Desc:   "Local file to also append the metrics to, in the Graphite plaintext format",
+		EnvVar: "METRICS_FILE",
+	})
+	influxURL := app.String(cli.StringOpt{
+		Name:   "influxdb-url",
+		Value:  "",
+		Desc:   "InfluxDB to also send the health of the services to, as http(s)://host:8086 or udp://host:8089; disabled if empty",
+		EnvVar: "INFLUXDB_URL",
+	})
+	influxDatabase := app.String(cli.StringOpt{
+		Name:   "influxdb-database",
+		Value:  "health",
+		Desc:   "InfluxDB database to write to over HTTP",
+		EnvVar: "INFLUXDB_DATABASE",
+	})
+	influxBatchSize := app.Int(cli.IntOpt{
+		Name:   "influxdb-batch-size",
+		Value:  500,
+		Desc:   "Maximum number of points sent to InfluxDB in one write",
+		EnvVar: "INFLUXDB_BATCH_SIZE",
+	})
+	statsdAddr := app.String(cli.StringOpt{
+		Name:   "statsd-address",
+		Value:  "",
+		Desc:   "StatsD agent to also send the health of the services to, as host:port; disabled if empty",
+		EnvVar: "STATSD_ADDRESS",
+	})
+	statsdPrefix := app.String(cli.StringOpt{
+		Name:   "statsd-prefix",
+		Value:  defaultGraphitePrefix,
+		Desc:   "Prefix of the StatsD metric names",
+		EnvVar: "STATSD_PREFIX",
+	})
+	statsdTags := app.Bool(cli.BoolOpt{
+		Name:   "statsd-tags",
+		Value:  false,
+		Desc:   "Send the environment, service and categories as DogStatsD tags rather than in the StatsD metric names",
+		EnvVar: "STATSD_TAGS",
+	})
+	slowCheckThresholdMs := app.Int(cli.IntOpt{
+		Name:   "slow-check-threshold-ms",
+		Value:  3000,
+		Desc:   "Healthy services whose healthcheck takes longer than this many milliseconds are reported as slow, with a warning severity; 0 disables it",
+		EnvVar: "SLOW_CHECK_THRESHOLD_MS",
+	})
+	execPluginDir := app.String(cli.StringOpt{
+		Name:   "exec-plugin-dir",
+		Value:  defaultExecPluginDir,
+		Desc:   "Directory of the Nagios plugins exec checks can run",
+		EnvVar: "EXEC_PLUGIN_DIR",
+	})
+	execMaxConcurrency := app.Int(cli.IntOpt{
+		Name:   "exec-max-concurrency",
+		Value:  4,
+		Desc:   "Maximum number of plugins of exec checks running at the same time",
+		EnvVar: "EXEC_MAX_CONCURRENCY",
+	})
+	technicalSummaryTemplate := app.String(cli.StringOpt{
+		Name:   "technical-summary-template",
+		Value:  defaultTechnicalSummaryTemplate,
+		Desc:   "Go template of the technical summary of the service checks, with the fields Service, ServiceGroup, Instance, Environment, Path and Categories",
+		EnvVar: "TECHNICAL_SUMMARY_TEMPLATE",
+	})
+	panicGuideTemplate := app.String(cli.StringOpt{
+		Name:   "panic-guide-template",
+		Value:  defaultPanicGuideTemplate,
+		Desc:   "Go template of the panic guide URL of the service checks, with the same fields as the technical summary template",
+		EnvVar: "PANIC_GUIDE_TEMPLATE",
+	})
 	environment := app.String(cli.StringOpt{
 		Name:   "environment",
 		Value:  "local",
@@ -64,25 +198,83 @@ func main() {
 		Desc:   "Comma-separated list of sev 1 apps",
 		EnvVar: "SEV_1_APPS",
 	})
+	webhooks := app.String(cli.StringOpt{
+		Name:   "webhooks",
+		Value:  "",
+		Desc:   "JSON list of webhooks to notify on state changes (e.g. [{\"url\": \"https://example.com/hook\", \"categories\": [\"read\"], \"minSeverity\": 1}])",
+		EnvVar: "WEBHOOKS",
+	})
+	slackWebhook := app.String(cli.StringOpt{
+		Name:   "slack-webhook",
+		Value:  "",
+		Desc:   "Slack-compatible incoming webhook to post state changes to",
+		EnvVar: "SLACK_WEBHOOK",
+	})
+	incidentEventsURL := app.String(cli.StringOpt{
+		Name:   "incident-events-url",
+		Value:  defaultIncidentEventsURL,
+		Desc:   "PagerDuty-style Events v2 API endpoint to open and resolve incidents with",
+		EnvVar: "INCIDENT_EVENTS_URL",
+	})
+	incidentRoutingKey := app.String(cli.StringOpt{
+		Name:   "incident-routing-key",
+		Value:  "",
+		Desc:   "Routing key of the incident integration; incidents are only raised if set",
+		EnvVar: "INCIDENT_ROUTING_KEY",
+	})
+	smtpAddr := app.String(cli.StringOpt{
+		Name:   "smtp-address",
+		Value:  "",
+		Desc:   "SMTP server address (e.g. smtp.example.com:587) to send email digests through; digests are only sent if set",
+		EnvVar: "SMTP_ADDRESS",
+	})
+	smtpUsername := app.String(cli.StringOpt{
+		Name:   "smtp-username",
+		Value:  "",
+		Desc:   "SMTP username, if the server requires authentication",
+		EnvVar: "SMTP_USERNAME",
+	})
+	smtpPassword := app.String(cli.StringOpt{
+		Name:   "smtp-password",
+		Value:  "",
+		Desc:   "SMTP password",
+		EnvVar: "SMTP_PASSWORD",
+	})
+	emailFrom := app.String(cli.StringOpt{
+		Name:   "email-from",
+		Value:  "aggregate-healthcheck@ft.com",
+		Desc:   "Sender address of email digests",
+		EnvVar: "EMAIL_FROM",
+	})
+	digestMinutes := app.Int(cli.IntOpt{
+		Name:   "email-digest-minutes",
+		Value:  15,
+		Desc:   "Period in minutes over which state changes are batched into one email digest",
+		EnvVar: "EMAIL_DIGEST_MINUTES",
+	})
 
 	app.Action = func() {
 		initLogs(os.Stdout, os.Stdout, os.Stderr)
+		var dialer proxy.Dialer = proxy.Direct
+		if *socksProxy != "" {
+			dialer, _ = proxy.SOCKS5("tcp", *socksProxy, nil, proxy.Direct)
+		}
 		transport := &http.Transport{
-			Dial: proxy.Direct.Dial,
-			ResponseHeaderTimeout: 10 * time.Second,
+			Dial:                  dialer.Dial,
+			ResponseHeaderTimeout: maxServiceTimeout,
 			MaxIdleConnsPerHost:   100,
 		}
-		if *socksProxy != "" {
-			dialer, _ := proxy.SOCKS5("tcp", *socksProxy, nil, proxy.Direct)
-			transport.Dial = dialer.Dial
-		}
 		httpClient := &http.Client{
 			Timeout:   5 * time.Second,
 			Transport: transport,
 		}
 
 		sos := strings.Split(*severityOneApps, ",")
-		checker := NewHTTPHealthChecker(httpClient, sos)
+		checker := NewCheckTypes(NewHTTPHealthChecker(httpClient, sos))
+		checker.register(plainHTTPStatusCheckType, NewPlainHTTPStatusChecker(httpClient))
+		checker.register(tcpConnectCheckType, NewTCPConnectChecker(dialer))
+		checker.register(grpcHealthCheckType, NewGRPCHealthChecker(dialer))
+		checker.register(execCheckType, NewExecChecker(*execPluginDir, *execMaxConcurrency))
 
 		cfg := etcdClient.Config{
 			Endpoints:               strings.Split(*etcdPeers, ","),
@@ -95,7 +287,41 @@ func main() {
 		}
 		etcdKeysAPI := etcdClient.NewKeysAPI(etcd)
 
+		notifier := NewNotifier(*environment)
+		webhookConfigs, err := parseWebhookConfigs(*webhooks)
+		if err != nil {
+			log.Fatal(err)
+		}
+		notificationClient := &http.Client{Timeout: 10 * time.Second}
+		for _, webhook := range webhookConfigs {
+			notifier.addSink(NewWebhookSink(webhook.URL, notificationClient), webhook.NotificationFilter)
+		}
+		if *incidentRoutingKey != "" {
+			notifier.addSink(NewIncidentSink(*incidentEventsURL, *incidentRoutingKey, notificationClient), NotificationFilter{})
+		}
+
+		checkDocs, err := NewCheckDocs(CheckDocTemplates{TechnicalSummary: *technicalSummaryTemplate, PanicGuide: *panicGuideTemplate})
+		if err != nil {
+			log.Fatal(err)
+		}
 		registry := NewCocoServiceRegistry(etcdKeysAPI, *vulcandAddr, checker, *environment)
+		registry.notifier = notifier
+		registry.docs = checkDocs
+		registry._slowThreshold = time.Duration(*slowCheckThresholdMs) * time.Millisecond
+		notifier.registry = registry
+		if *slackWebhook != "" {
+			notifier.addSink(NewSlackSink(*slackWebhook, notificationClient, registry), NotificationFilter{})
+		}
+		if *smtpAddr != "" {
+			var auth smtp.Auth
+			if *smtpUsername != "" {
+				smtpHost, _, _ := net.SplitHostPort(*smtpAddr)
+				auth = smtp.PlainAuth("", *smtpUsername, *smtpPassword, smtpHost)
+			}
+			digestSink := NewDigestSink(*smtpAddr, auth, *emailFrom, registry)
+			delivery := notifier.addSink(digestSink, NotificationFilter{})
+			go digestSink.sendDigests(time.Duration(*digestMinutes)*time.Minute, delivery)
+		}
 		registry.redefineCategoryList()
 		registry.redefineServiceList()
 		registry.redefineClusterAck()
@@ -105,19 +331,68 @@ func main() {
 		go registry.watchCategories()
 		go registry.watchClusterAck()
 
-		graphiteFeeder := NewGraphiteFeeder(*graphiteHost, *graphitePort, *environment, registry)
-		go graphiteFeeder.feed()
+		graphiteNaming, err := NewGraphiteNaming(*graphitePrefix, *environment, GraphiteTemplates{
+			Pilot:         *graphitePilotTemplate,
+			Service:       *graphiteServiceTemplate,
+			ServiceSeries: *graphiteServiceSeriesTemplate,
+			Category:      *graphiteCategoryTemplate,
+			Cluster:       *graphiteClusterTemplate,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		graphiteAddrs, err := parseGraphiteAddresses(*graphiteHost, *graphitePort)
+		if err != nil {
+			log.Fatal(err)
+		}
 
 		controller := NewController(registry, environment)
+		controller.selfChecks = selfHealth
+		metricsFeeder := NewMetricsFeeder(registry, controller)
+		for _, addr := range graphiteAddrs {
+			graphiteTransport, err := NewGraphiteTransport(*graphiteProtocol, addr)
+			if err != nil {
+				log.Fatal(err)
+			}
+			graphiteSink := NewGraphiteSink(graphiteTransport, graphiteNaming, *graphiteBatchSize)
+			if *graphiteSpoolPath != "" {
+				spoolPath := *graphiteSpoolPath
+				if len(graphiteAddrs) > 1 {
+					spoolPath += "." + sanitiseGraphiteNode(strings.Replace(addr, ":", "_", -1))
+				}
+				graphiteSink.spool, err = NewGraphiteSpool(spoolPath, int64(*graphiteSpoolMaxMB)*1024*1024)
+				if err != nil {
+					log.Fatal(err)
+				}
+			}
+			metricsFeeder.addSink(graphiteSink)
+		}
+		if *metricsFile != "" {
+			metricsFeeder.addSink(NewMetricsFileSink(*metricsFile, graphiteNaming))
+		}
+		if *influxURL != "" {
+			influxTransport, err := NewInfluxTransport(*influxURL, *influxDatabase, &http.Client{Timeout: 10 * time.Second})
+			if err != nil {
+				log.Fatal(err)
+			}
+			metricsFeeder.addSink(NewInfluxSink(influxTransport, *environment, *influxBatchSize))
+		}
+		if *statsdAddr != "" {
+			metricsFeeder.addSink(NewStatsdSink(*statsdAddr, *statsdPrefix, *environment, *statsdTags))
+		}
+		go metricsFeeder.feed()
+		go notifier.monitorCategories(controller, categoryMonitoringPeriod)
 
 		handler := controller.handleHealthcheck
 		gtgHandler := controller.handleGoodToGo
 		aggHandler := controller.handleAggHealthcheck
 		r := mux.NewRouter()
-		r.HandleFunc("/", handler)
-		r.HandleFunc("/__health", handler)
-		r.HandleFunc("/__gtg", gtgHandler)
-		r.HandleFunc("/__agghealth", aggHandler)
+		r.HandleFunc("/", instrumented("/", handler))
+		r.HandleFunc("/__health", instrumented("/__health", handler))
+		r.HandleFunc("/__gtg", instrumented("/__gtg", gtgHandler))
+		r.HandleFunc("/__agghealth", instrumented("/__agghealth", aggHandler))
+		r.HandleFunc("/__notifications", instrumented("/__notifications", notifier.handleDeliveryStatus))
+		r.HandleFunc("/metrics", instrumented("/metrics", controller.handleMetrics))
 		err = http.ListenAndServe(":8080", r)
 		if err != nil {
 			errorLogger.Println("Can't set up HTTP listener on 8080.")
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	initLogs(os.Stdout, os.Stdout, os.Stderr)
+	os.Exit(m.Run())
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	gaugeType           = "gauge"
+	counterType         = "counter"
+	histogramType       = "histogram"
+	exposingContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// metricFamily is a set of samples written in the Prometheus text exposition format.
+type metricFamily struct {
+	name    string
+	help    string
+	kind    string
+	samples []metricSample
+}
+
+type metricSample struct {
+	suffix string
+	labels []metricLabel
+	value  float64
+}
+
+type metricLabel struct {
+	name  string
+	value string
+}
+
+func newMetricFamily(name string, kind string, help string) *metricFamily {
+	return &metricFamily{name: name, kind: kind, help: help}
+}
+
+func (f *metricFamily) add(value float64, labels ...metricLabel) {
+	f.samples = append(f.samples, metricSample{"", labels, value})
+}
+
+// addSuffixed adds a sample with a suffixed name, like the _bucket, _sum and _count samples of histograms.
+func (f *metricFamily) addSuffixed(suffix string, value float64, labels ...metricLabel) {
+	f.samples = append(f.samples, metricSample{suffix, labels, value})
+}
+
+func (f *metricFamily) writeTo(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, f.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+	for _, sample := range f.samples {
+		fmt.Fprintf(w, "%s%s%s %s\n", f.name, sample.suffix, formatLabels(sample.labels), formatValue(sample.value))
+	}
+}
+
+func formatLabels(labels []metricLabel) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var pairs []string
+	for _, label := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", label.name, labelValueEscaper.Replace(label.value)))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelValueEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// handleMetrics exposes the latest cached health of every service, along with the health of every category
+// and of the whole cluster, in the Prometheus exposition format.
+func (c Controller) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	environment := metricLabel{"environment", *c.environment}
+
+	up := newMetricFamily("aggregate_health_service_up", gaugeType, "Whether the service is healthy (1) or not (0).")
+	severity := newMetricFamily("aggregate_health_service_severity", gaugeType, "Severity of the service failing, 1 being critical.")
+	acked := newMetricFamily("aggregate_health_service_acked", gaugeType, "Whether the service is acked (1) or not (0).")
+	latency := newMetricFamily("aggregate_health_service_check_latency_seconds", gaugeType, "Duration of the latest check of the service.")
+	lastCheck := newMetricFamily("aggregate_health_service_last_check_timestamp_seconds", gaugeType, "Time of the latest check of the service.")
+
+	measuredServices := c.registry.measuredServices()
+	var names []string
+	for name := range measuredServices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		mService := measuredServices[name]
+		healthResult := <-mService.cachedHealth.toReadFromCache
+		if len(healthResult.Checks) == 0 {
+			continue
+		}
+		check := healthResult.Checks[0]
+		for _, category := range mService.service.Categories {
+			labels := []metricLabel{{"service", name}, {"category", category}, environment}
+			up.add(boolToFloat(check.Ok), labels...)
+			severity.add(float64(check.Severity), labels...)
+			acked.add(boolToFloat(check.Ack != ""), labels...)
+			latency.add(healthResult.Latency.Seconds(), labels...)
+			lastCheck.add(float64(check.LastUpdated.Unix()), labels...)
+		}
+	}
+
+	clusterHealthy := newMetricFamily("aggregate_health_cluster_healthy", gaugeType, "Whether the services of the default category are healthy (1) or not (0).")
+	clusterAcked := newMetricFamily("aggregate_health_cluster_acked", gaugeType, "Whether the cluster is acked (1) or not (0).")
+	categoryHealthy := newMetricFamily("aggregate_health_category_healthy", gaugeType, "Whether the services of the category are healthy (1) or not (0).")
+
+	// the health of the cluster being the one of the default category
+	categories := []string{defaultCategoryName}
+	for name := range c.registry.categories() {
+		if name != defaultCategoryName {
+			categories = append(categories, name)
+		}
+	}
+	sort.Strings(categories)
+	categoriesHealth := c.cachedCategoriesHealth(categories)
+	clusterHealthy.add(boolToFloat(categoriesHealth[defaultCategoryName]), environment)
+	clusterAcked.add(boolToFloat(c.registry.clusterAck() != ""), environment)
+	for _, category := range categories {
+		categoryHealthy.add(boolToFloat(categoriesHealth[category]), metricLabel{"category", category}, environment)
+	}
+
+	w.Header().Set("Content-Type", exposingContentType)
+	buffered := bufio.NewWriter(w)
+	families := []*metricFamily{up, severity, acked, latency, lastCheck, clusterHealthy, clusterAcked, categoryHealthy}
+	for _, family := range append(families, selfMetrics.families()...) {
+		family.writeTo(buffered)
+	}
+	buffered.Flush()
+}
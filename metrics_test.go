@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	fthealth "github.com/Financial-Times/go-fthealth/v1a"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestHandleMetrics(t *testing.T) {
+	registry := new(MockRegistry)
+
+	healthy := NewMeasuredService(&Service{Name: "foo-service-1", Categories: []string{"default", "read"}})
+	unhealthy := NewMeasuredService(&Service{Name: "bar-service-1", Categories: []string{"default"}})
+	lastUpdated := time.Unix(1500000000, 0)
+	healthy.cachedHealth.toWriteToCache <- MeasuredHealth{
+		HealthResult: fthealth.HealthResult{Checks: []fthealth.CheckResult{{Name: "foo-service-1", Ok: true, Severity: 2, LastUpdated: lastUpdated}}},
+		Latency:      250 * time.Millisecond,
+	}
+	unhealthy.cachedHealth.toWriteToCache <- MeasuredHealth{
+		HealthResult: fthealth.HealthResult{Checks: []fthealth.CheckResult{{Name: "bar-service-1", Ok: false, Severity: 1, Ack: "on it", LastUpdated: lastUpdated}}},
+		Latency:      time.Second,
+	}
+
+	registry.On("measuredServices").Return(map[string]MeasuredService{"foo-service-1": healthy, "bar-service-1": unhealthy})
+	mockCategories(registry, []string{"default", "read"}, []string{})
+	registry.On("matchingCategories", mock.Anything).Return([]string{"default"})
+	registry.On("areResilient", mock.Anything).Return(false)
+
+	env := "test"
+	controller := NewController(registry, &env)
+
+	req, _ := http.NewRequest("GET", "http://www.example.com/metrics", nil)
+	w := httptest.NewRecorder()
+	controller.handleMetrics(w, req)
+
+	body := w.Body.String()
+	assert.Equal(t, exposingContentType, w.Header().Get("Content-Type"))
+	assert.Contains(t, body, "# TYPE aggregate_health_service_up gauge\n")
+	assert.Contains(t, body, `aggregate_health_service_up{service="foo-service-1",category="default",environment="test"} 1`+"\n")
+	assert.Contains(t, body, `aggregate_health_service_up{service="foo-service-1",category="read",environment="test"} 1`+"\n")
+	assert.Contains(t, body, `aggregate_health_service_up{service="bar-service-1",category="default",environment="test"} 0`+"\n")
+	assert.Contains(t, body, `aggregate_health_service_severity{service="bar-service-1",category="default",environment="test"} 1`+"\n")
+	assert.Contains(t, body, `aggregate_health_service_acked{service="bar-service-1",category="default",environment="test"} 1`+"\n")
+	assert.Contains(t, body, `aggregate_health_service_check_latency_seconds{service="foo-service-1",category="read",environment="test"} 0.25`+"\n")
+	assert.Contains(t, body, `aggregate_health_service_last_check_timestamp_seconds{service="foo-service-1",category="read",environment="test"} 1.5e+09`+"\n")
+	assert.Contains(t, body, `aggregate_health_cluster_healthy{environment="test"} 1`+"\n", "the unhealthy service is acked")
+	assert.Contains(t, body, `aggregate_health_cluster_acked{environment="test"} 0`+"\n")
+	assert.Contains(t, body, `aggregate_health_category_healthy{category="read",environment="test"} 1`+"\n")
+	assert.Contains(t, body, `aggregate_health_category_healthy{category="default",environment="test"} 1`+"\n")
+}
+
+func TestFormatLabelsEscapesValues(t *testing.T) {
+	assert.Equal(t, `{output="say \"hi\"\\n\n"}`, formatLabels([]metricLabel{{"output", "say \"hi\"\\n\n"}}))
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	metricsFeedPeriod    = 60 * time.Second
+	metricsSinkQueueSize = 10
+)
+
+// ServiceResult is a health measurement of a service.
+type ServiceResult struct {
+	Service Service
+	Health  MeasuredHealth
+}
+
+// HealthSnapshot is what every metrics sink gets fed periodically: the health measurements of the services
+// since the previous snapshot, along with the current health of every category and of the cluster.
+type HealthSnapshot struct {
+	Time          time.Time
+	Results       []ServiceResult
+	Categories    map[string]bool
+	ClusterHealth bool
+}
+
+// MetricsSink is a destination of the health metrics, like a Graphite host. Sinks keep the metrics they
+// fail to send, to be sent along with the next snapshot.
+type MetricsSink interface {
+	Name() string
+	Send(HealthSnapshot) error
+}
+
+// sinkConnection is the connection of a sink to its metrics backend.
+type sinkConnection interface {
+	connect() error
+	isConnected() bool
+	address() string
+}
+
+// connectSink (re)connects the sink to its backend and records whether it is connected.
+func connectSink(sink string, conn sinkConnection) {
+	if err := conn.connect(); err != nil {
+		warnLogger.Printf("[%v]", err.Error())
+	}
+	selfHealth.sinkConnection(sink, conn.isConnected())
+}
+
+// reconnectSink reconnects the sink after a failure to send metrics.
+func reconnectSink(sink string, conn sinkConnection) {
+	infoLogger.Printf("Reconnecting %v.", sink)
+	selfMetrics.sinkReconnects.inc(sink)
+	connectSink(sink, conn)
+}
+
+// sendInBatches sends count metrics in batches of batchSize, returning how many were sent.
+func sendInBatches(count int, batchSize int, send func(from, to int) error) (int, error) {
+	sent := 0
+	for sent < count {
+		end := sent + batchSize
+		if end > count || batchSize <= 0 {
+			end = count
+		}
+		if err := send(sent, end); err != nil {
+			return sent, err
+		}
+		sent = end
+	}
+	return sent, nil
+}
+
+// excessPending is how many of the pending metrics of the sink exceed its capacity, recording them as dropped.
+func excessPending(sink string, pending int, capacity int) int {
+	excess := pending - capacity
+	if excess <= 0 {
+		return 0
+	}
+	selfMetrics.sinkDrops.add(sink, float64(excess))
+	return excess
+}
+
+type BufferedHealths struct {
+	buffer chan MeasuredHealth
+}
+
+func NewBufferedHealths() *BufferedHealths {
+	buffer := make(chan MeasuredHealth, 60)
+	return &BufferedHealths{buffer}
+}
+
+// MetricsFeeder periodically takes a snapshot of the health of the cluster and feeds it to every sink,
+// each sink having its own queue so that a slow or unavailable one doesn't hold up the others.
+type MetricsFeeder struct {
+	registry   ServiceRegistry
+	controller *Controller
+	ticker     *time.Ticker
+	deliveries []*metricsDelivery
+}
+
+type metricsDelivery struct {
+	sink  MetricsSink
+	queue chan HealthSnapshot
+}
+
+func NewMetricsFeeder(registry ServiceRegistry, controller *Controller) *MetricsFeeder {
+	return &MetricsFeeder{registry: registry, controller: controller, ticker: time.NewTicker(metricsFeedPeriod)}
+}
+
+func (f *MetricsFeeder) addSink(sink MetricsSink) {
+	delivery := &metricsDelivery{sink: sink, queue: make(chan HealthSnapshot, metricsSinkQueueSize)}
+	f.deliveries = append(f.deliveries, delivery)
+	go delivery.deliver()
+}
+
+func (f *MetricsFeeder) feed() {
+	for range f.ticker.C {
+		snapshot := f.snapshot()
+		for _, delivery := range f.deliveries {
+			delivery.enqueue(snapshot)
+		}
+	}
+}
+
+func (f *MetricsFeeder) snapshot() HealthSnapshot {
+	snapshot := HealthSnapshot{Time: time.Now(), Categories: make(map[string]bool)}
+	for _, mService := range f.registry.measuredServices() {
+		for drained := false; !drained; {
+			select {
+			case health := <-mService.bufferedHealths.buffer:
+				snapshot.Results = append(snapshot.Results, ServiceResult{*mService.service, health})
+			default:
+				drained = true
+			}
+		}
+	}
+	sort.Stable(byServiceName(snapshot.Results))
+
+	// the health of the cluster is the one of the default category, computed along with the others without logging
+	registered := f.registry.categories()
+	categories := []string{defaultCategoryName}
+	for name := range registered {
+		if name != defaultCategoryName {
+			categories = append(categories, name)
+		}
+	}
+	categoriesHealth := f.controller.cachedCategoriesHealth(categories)
+	snapshot.ClusterHealth = categoriesHealth[defaultCategoryName]
+	for name := range registered {
+		snapshot.Categories[name] = categoriesHealth[name]
+	}
+	return snapshot
+}
+
+// enqueue drops the oldest snapshot queued if the sink can't keep up.
+func (d *metricsDelivery) enqueue(snapshot HealthSnapshot) {
+	for {
+		select {
+		case d.queue <- snapshot:
+			return
+		default:
+		}
+		select {
+		case <-d.queue:
+			selfMetrics.sinkDrops.inc(d.sink.Name())
+			warnLogger.Printf("Metrics queue of %v is full, dropping the oldest snapshot.", d.sink.Name())
+		default:
+		}
+	}
+}
+
+func (d *metricsDelivery) deliver() {
+	for snapshot := range d.queue {
+		if err := d.sink.Send(snapshot); err != nil {
+			warnLogger.Printf("Failed to send metrics to %v: [%v]", d.sink.Name(), err.Error())
+		}
+	}
+}
+
+type byServiceName []ServiceResult
+
+func (s byServiceName) Less(i, j int) bool {
+	return s[i].Service.Name < s[j].Service.Name
+}
+
+func (s byServiceName) Len() int {
+	return len(s)
+}
+func (s byServiceName) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
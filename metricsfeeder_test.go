@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	fthealth "github.com/Financial-Times/go-fthealth/v1a"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockMetricsSink struct {
+	snapshots []HealthSnapshot
+}
+
+func (s *MockMetricsSink) Name() string {
+	return "mock"
+}
+
+func (s *MockMetricsSink) Send(snapshot HealthSnapshot) error {
+	s.snapshots = append(s.snapshots, snapshot)
+	return nil
+}
+
+func TestMetricsDeliveryDropsOldestSnapshots(t *testing.T) {
+	delivery := &metricsDelivery{sink: &MockMetricsSink{}, queue: make(chan HealthSnapshot, 2)}
+
+	for i := 0; i < 3; i++ {
+		delivery.enqueue(HealthSnapshot{Time: time.Unix(int64(i), 0)})
+	}
+
+	assert.Equal(t, time.Unix(1, 0), (<-delivery.queue).Time)
+	assert.Equal(t, time.Unix(2, 0), (<-delivery.queue).Time)
+}
+
+func TestMetricsFeederSnapshot(t *testing.T) {
+	registry := new(MockRegistry)
+
+	healthy := NewMeasuredService(&Service{Name: "foo-service-1", Categories: []string{"default", "read"}})
+	unhealthy := NewMeasuredService(&Service{Name: "bar-service-1", Categories: []string{"default", "publish"}})
+	healthy.cachedHealth.toWriteToCache <- measured(fthealth.CheckResult{Name: "foo-service-1", Ok: true, Severity: 2})
+	unhealthy.cachedHealth.toWriteToCache <- measured(fthealth.CheckResult{Name: "bar-service-1", Ok: false, Severity: 1})
+	unhealthy.bufferedHealths.buffer <- measured(fthealth.CheckResult{Name: "bar-service-1", Ok: false, Severity: 1})
+
+	registry.On("measuredServices").Return(map[string]MeasuredService{"foo-service-1": healthy, "bar-service-1": unhealthy})
+	mockCategories(registry, []string{"default", "read", "publish"}, []string{})
+	registry.On("areResilient", mock.Anything).Return(false)
+
+	env := "test"
+	feeder := &MetricsFeeder{registry: registry, controller: NewController(registry, &env)}
+	snapshot := feeder.snapshot()
+
+	assert.Len(t, snapshot.Results, 1)
+	assert.Equal(t, "bar-service-1", snapshot.Results[0].Service.Name)
+	assert.False(t, snapshot.ClusterHealth)
+	assert.Equal(t, map[string]bool{"default": false, "read": true, "publish": false}, snapshot.Categories)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+)
+
+// MetricsFileSink appends the health metrics to a local file, in the Graphite plaintext format.
+type MetricsFileSink struct {
+	path   string
+	naming *GraphiteNaming
+}
+
+func NewMetricsFileSink(path string, naming *GraphiteNaming) *MetricsFileSink {
+	return &MetricsFileSink{path: path, naming: naming}
+}
+
+func (s *MetricsFileSink) Name() string {
+	return "file " + s.path
+}
+
+func (s *MetricsFileSink) Send(snapshot HealthSnapshot) error {
+	var buf bytes.Buffer
+	for _, metric := range graphiteMetricsFor(s.naming, snapshot) {
+		buf.WriteString(metric.String())
+	}
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("Can't open metrics file %v: %v", s.path, err.Error())
+	}
+	defer file.Close()
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("Can't write to metrics file %v: %v", s.path, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	serviceStateChanged  = "service-state-changed"
+	categoryStateChanged = "category-state-changed"
+	serviceAcked         = "service-acked"
+	serviceAckRemoved    = "service-ack-removed"
+	clusterAcked         = "cluster-acked"
+	clusterAckRemoved    = "cluster-ack-removed"
+	categoryDisabled     = "category-disabled"
+
+	notificationQueueSize    = 100
+	defaultDeliveryAttempts  = 3
+	defaultRetryInterval     = 5 * time.Second
+	categoryMonitoringPeriod = 30 * time.Second
+)
+
+// Notification is the payload delivered to every notification sink whenever a service or category changes state,
+// an ack is added or removed, or a sticky category gets disabled.
+type Notification struct {
+	Event         string    `json:"event"`
+	Environment   string    `json:"environment"`
+	Service       string    `json:"service,omitempty"`
+	Category      string    `json:"category,omitempty"`
+	Categories    []string  `json:"categories,omitempty"`
+	Ok            bool      `json:"ok"`
+	Slow          bool      `json:"slow,omitempty"`
+	Severity      uint8     `json:"severity,omitempty"`
+	Output        string    `json:"output,omitempty"`
+	FailingChecks []check   `json:"failingChecks,omitempty"`
+	PanicGuide    string    `json:"panicGuide,omitempty"`
+	Team          string    `json:"team,omitempty"`
+	SystemCode    string    `json:"systemCode,omitempty"`
+	Ack           string    `json:"ack,omitempty"`
+	ClusterAck    string    `json:"clusterAck,omitempty"`
+	Time          time.Time `json:"time"`
+}
+
+// summary describes the notification in a single human readable line.
+func (n Notification) summary() string {
+	switch n.Event {
+	case serviceStateChanged:
+		if n.Slow {
+			return fmt.Sprintf("%v is healthy but slow in %v", n.Service, n.Environment)
+		}
+		return fmt.Sprintf("%v is %v in %v", n.Service, healthWord(n.Ok), n.Environment)
+	case categoryStateChanged:
+		return fmt.Sprintf("Category %v is %v in %v", n.Category, healthWord(n.Ok), n.Environment)
+	case serviceAcked:
+		return fmt.Sprintf("%v has been acked in %v: %v", n.Service, n.Environment, n.Ack)
+	case serviceAckRemoved:
+		return fmt.Sprintf("Ack removed from %v in %v", n.Service, n.Environment)
+	case clusterAcked:
+		return fmt.Sprintf("%v cluster has been acked: %v", n.Environment, n.Ack)
+	case clusterAckRemoved:
+		return fmt.Sprintf("Ack removed from %v cluster", n.Environment)
+	case categoryDisabled:
+		return fmt.Sprintf("Sticky category %v has been disabled in %v", n.Category, n.Environment)
+	case serviceEscalated:
+		return fmt.Sprintf("%v is still unhealthy in %v, escalated to critical", n.Service, n.Environment)
+	case categoryEscalated:
+		return fmt.Sprintf("Category %v is still unhealthy in %v, escalated to critical", n.Category, n.Environment)
+	}
+	return fmt.Sprintf("%v in %v", n.Event, n.Environment)
+}
+
+// failingChecksSummary lists the failing inner checks of the service, one per line along with their output.
+func (n Notification) failingChecksSummary() string {
+	var lines []string
+	for _, failing := range n.FailingChecks {
+		line := failing.Name
+		if failing.CheckOutput != "" {
+			line += ": " + failing.CheckOutput
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func healthWord(ok bool) string {
+	if ok {
+		return "healthy"
+	}
+	return "unhealthy"
+}
+
+func severityName(severity uint8) string {
+	switch severity {
+	case 1:
+		return "critical"
+	case 2:
+		return "warning"
+	}
+	return "info"
+}
+
+type NotificationSink interface {
+	Name() string
+	Send(Notification) error
+}
+
+// NotificationFilter restricts the notifications a sink receives. Severity follows the FT convention,
+// so a MinSeverity of 1 only lets critical notifications through. Notifications not tied to any
+// category or severity (e.g. cluster acks) are always let through.
+type NotificationFilter struct {
+	Categories  []string `json:"categories"`
+	MinSeverity uint8    `json:"minSeverity"`
+}
+
+func (f NotificationFilter) matches(n Notification) bool {
+	if f.MinSeverity != 0 && n.Severity != 0 && n.Severity > f.MinSeverity {
+		return false
+	}
+	if len(f.Categories) == 0 || len(n.Categories) == 0 {
+		return true
+	}
+	return containsAtLeastOneFrom(f.Categories, n.Categories)
+}
+
+type DeliveryStatus struct {
+	Sink          string     `json:"sink"`
+	Queued        int        `json:"queued"`
+	Delivered     int        `json:"delivered"`
+	Retried       int        `json:"retried"`
+	Deduplicated  int        `json:"deduplicated"`
+	Throttled     int        `json:"throttled"`
+	Failed        int        `json:"failed"`
+	Dropped       int        `json:"dropped"`
+	LastError     string     `json:"lastError,omitempty"`
+	LastAttempt   *time.Time `json:"lastAttempt,omitempty"`
+	LastDelivered *time.Time `json:"lastDelivered,omitempty"`
+}
+
+type sinkDelivery struct {
+	sync.Mutex
+	sink          NotificationSink
+	filter        NotificationFilter
+	queue         chan Notification
+	stopped       chan struct{}
+	maxAttempts   int
+	retryInterval time.Duration
+	status        DeliveryStatus
+	subjects      map[string]*throttledSubject
+}
+
+type serviceState struct {
+	ok   bool
+	slow bool
+	ack  string
+}
+
+type Notifier struct {
+	sync.Mutex
+	environment    string
+	registry       ServiceRegistry
+	deliveries     []*sinkDelivery
+	serviceStates  map[string]serviceState
+	categoryStates map[string]bool
+	clusterAck     *string
+	escalations    map[string]*escalation
+	// the most severe severity every ongoing failure was reported with, by subject
+	failureSeverities map[string]uint8
+}
+
+func NewNotifier(environment string) *Notifier {
+	return &Notifier{
+		environment:       environment,
+		serviceStates:     make(map[string]serviceState),
+		categoryStates:    make(map[string]bool),
+		escalations:       make(map[string]*escalation),
+		failureSeverities: make(map[string]uint8),
+	}
+}
+
+func (n *Notifier) addSink(sink NotificationSink, filter NotificationFilter) *sinkDelivery {
+	delivery := &sinkDelivery{
+		sink:          sink,
+		filter:        filter,
+		queue:         make(chan Notification, notificationQueueSize),
+		stopped:       make(chan struct{}),
+		maxAttempts:   defaultDeliveryAttempts,
+		retryInterval: defaultRetryInterval,
+		status:        DeliveryStatus{Sink: sink.Name()},
+		subjects:      make(map[string]*throttledSubject),
+	}
+	n.Lock()
+	n.deliveries = append(n.deliveries, delivery)
+	n.Unlock()
+	go delivery.deliver()
+	return delivery
+}
+
+// stop stops the pending escalations and the delivery of notifications to every sink, dropping the queued ones.
+func (n *Notifier) stop() {
+	n.Lock()
+	defer n.Unlock()
+	for key, esc := range n.escalations {
+		esc.timer.Stop()
+		delete(n.escalations, key)
+	}
+	for _, delivery := range n.deliveries {
+		delivery.stop()
+	}
+	n.deliveries = nil
+}
+
+// observeService is fed every fresh measurement of a service and publishes state and ack changes, a healthy
+// service getting slower than the slow check threshold or back being a change of state too. The first
+// measurement seen for a service only sets the baseline.
+func (n *Notifier) observeService(service Service, result MeasuredHealth) {
+	check := result.Checks[0]
+	slow := check.Ok && result.Slow
+	n.Lock()
+	previous, known := n.serviceStates[service.Name]
+	n.serviceStates[service.Name] = serviceState{check.Ok, slow, check.Ack}
+	n.Unlock()
+
+	notification := Notification{
+		Event:         serviceStateChanged,
+		Service:       service.Name,
+		Categories:    service.Categories,
+		Ok:            check.Ok,
+		Slow:          slow,
+		Severity:      check.Severity,
+		Output:        check.Output,
+		PanicGuide:    check.PanicGuide,
+		FailingChecks: result.Healthcheck.failingChecks(),
+		Team:          service.Team,
+		SystemCode:    service.SystemCode,
+		Ack:           check.Ack,
+	}
+	n.trackFailureSeverity(&notification)
+	n.trackEscalation(notification, serviceEscalated)
+	if !known {
+		return
+	}
+
+	if previous.ack != check.Ack {
+		if check.Ack != "" {
+			notification.Event = serviceAcked
+		} else {
+			notification.Event = serviceAckRemoved
+		}
+		n.publish(notification)
+	}
+	if previous.ok != check.Ok || previous.slow != slow {
+		notification.Event = serviceStateChanged
+		n.publish(notification)
+	}
+}
+
+// observeCategory is fed the computed health of a category and publishes its state changes.
+func (n *Notifier) observeCategory(category string, ok bool, severity uint8) {
+	n.Lock()
+	previous, known := n.categoryStates[category]
+	n.categoryStates[category] = ok
+	n.Unlock()
+
+	notification := Notification{
+		Event:      categoryStateChanged,
+		Category:   category,
+		Categories: []string{category},
+		Ok:         ok,
+		Severity:   severity,
+	}
+	n.trackFailureSeverity(&notification)
+	n.trackEscalation(notification, categoryEscalated)
+	if !known || previous == ok {
+		return
+	}
+	n.publish(notification)
+}
+
+// trackFailureSeverity records the most severe severity the ongoing failure of the subject of the notification
+// was reported with, and gives it to the notification of its recovery, so that the recovery reaches every sink
+// filtering by severity which the failure reached.
+func (n *Notifier) trackFailureSeverity(notification *Notification) {
+	key := notification.throttleKey()
+
+	n.Lock()
+	defer n.Unlock()
+	severity, failing := n.failureSeverities[key]
+	if notification.Ok {
+		if failing {
+			notification.Severity = severity
+			delete(n.failureSeverities, key)
+		}
+		return
+	}
+	if notification.Severity != 0 && (!failing || notification.Severity < severity) {
+		n.failureSeverities[key] = notification.Severity
+	}
+}
+
+func (n *Notifier) observeClusterAck(ack string) {
+	n.Lock()
+	previous := n.clusterAck
+	n.clusterAck = &ack
+	n.Unlock()
+	if previous == nil || *previous == ack {
+		return
+	}
+	event := clusterAcked
+	if ack == "" {
+		event = clusterAckRemoved
+	}
+	n.publish(Notification{Event: event, Ack: ack})
+}
+
+func (n *Notifier) categoryDisabled(category string) {
+	n.publish(Notification{
+		Event:      categoryDisabled,
+		Category:   category,
+		Categories: []string{category},
+	})
+}
+
+// monitorCategories periodically evaluates the health of every category from the cache, so category
+// transitions get noticed even if nobody is polling the healthcheck endpoints.
+func (n *Notifier) monitorCategories(controller *Controller, period time.Duration) {
+	ticker := time.NewTicker(period)
+	for range ticker.C {
+		var names []string
+		for name := range n.registry.categories() {
+			names = append(names, name)
+		}
+		_, categorisedResults := controller.collectChecksFromCachesFor(names)
+		for category, results := range categorisedResults {
+			ok, severity := controller.computeCategoryHealthResult(category, results)
+			n.observeCategory(category, ok, severity)
+		}
+	}
+}
+
+func (n *Notifier) publish(notification Notification) {
+	n.Lock()
+	notification.Environment = n.environment
+	if n.clusterAck != nil {
+		notification.ClusterAck = *n.clusterAck
+	}
+	deliveries := n.deliveries
+	n.Unlock()
+	notification.Time = time.Now().UTC()
+
+	policy := n.policyFor(notification.Categories)
+	for _, delivery := range deliveries {
+		if delivery.filter.matches(notification) {
+			delivery.offer(notification, policy.Interval)
+		}
+	}
+}
+
+func (n *Notifier) deliveryStatuses() []DeliveryStatus {
+	n.Lock()
+	deliveries := n.deliveries
+	n.Unlock()
+
+	statuses := []DeliveryStatus{}
+	for _, delivery := range deliveries {
+		statuses = append(statuses, delivery.currentStatus())
+	}
+	return statuses
+}
+
+func (n *Notifier) handleDeliveryStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(n.deliveryStatuses()); err != nil {
+		panic("Couldn't encode notification delivery status to ResponseWriter.")
+	}
+}
+
+func (d *sinkDelivery) enqueue(notification Notification) {
+	select {
+	case d.queue <- notification:
+	default:
+		d.Lock()
+		d.status.Dropped++
+		d.Unlock()
+		warnLogger.Printf("Notification queue of %v is full, dropping %v notification.", d.sink.Name(), notification.Event)
+	}
+}
+
+func (d *sinkDelivery) deliver() {
+	for {
+		select {
+		case notification := <-d.queue:
+			d.deliverOne(notification)
+		case <-d.stopped:
+			return
+		}
+	}
+}
+
+func (d *sinkDelivery) stop() {
+	close(d.stopped)
+}
+
+func (d *sinkDelivery) deliverOne(notification Notification) {
+	for attempt := 1; attempt <= d.maxAttempts; attempt++ {
+		err := d.sink.Send(notification)
+		now := time.Now().UTC()
+
+		d.Lock()
+		d.status.LastAttempt = &now
+		if err == nil {
+			d.status.Delivered++
+			d.status.LastDelivered = &now
+			d.Unlock()
+			return
+		}
+		d.status.LastError = err.Error()
+		if attempt == d.maxAttempts {
+			d.status.Failed++
+		} else {
+			d.status.Retried++
+		}
+		d.Unlock()
+
+		warnLogger.Printf("Failed to deliver %v notification to %v (attempt %d/%d): [%v]", notification.Event, d.sink.Name(), attempt, d.maxAttempts, err.Error())
+		if attempt < d.maxAttempts {
+			select {
+			case <-time.After(time.Duration(attempt) * d.retryInterval):
+			case <-d.stopped:
+				return
+			}
+		}
+	}
+}
+
+// recordFailure records a failure of the sink to send notifications it accepted earlier, like the email digests
+// sent at the end of their window.
+func (d *sinkDelivery) recordFailure(err error) {
+	now := time.Now().UTC()
+	d.Lock()
+	defer d.Unlock()
+	d.status.LastAttempt = &now
+	d.status.LastError = err.Error()
+	d.status.Failed++
+}
+
+func (d *sinkDelivery) currentStatus() DeliveryStatus {
+	d.Lock()
+	defer d.Unlock()
+	status := d.status
+	status.Queued = len(d.queue)
+	return status
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	fthealth "github.com/Financial-Times/go-fthealth/v1a"
+	"github.com/coreos/etcd/client"
+	"github.com/stretchr/testify/assert"
+)
+
+type TestSink struct {
+	notifications chan Notification
+}
+
+func NewTestSink() *TestSink {
+	return &TestSink{make(chan Notification, 10)}
+}
+
+func (s *TestSink) Name() string {
+	return "test"
+}
+
+func (s *TestSink) Send(n Notification) error {
+	s.notifications <- n
+	return nil
+}
+
+func (s *TestSink) next(t *testing.T) Notification {
+	select {
+	case n := <-s.notifications:
+		return n
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a notification")
+	}
+	return Notification{}
+}
+
+func (s *TestSink) assertNothingSent(t *testing.T) {
+	select {
+	case n := <-s.notifications:
+		t.Fatalf("unexpected notification %v", n.Event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// measured is the measurement of a service with the given check result.
+func measured(check fthealth.CheckResult) MeasuredHealth {
+	return MeasuredHealth{HealthResult: fthealth.HealthResult{Checks: []fthealth.CheckResult{check}}}
+}
+
+func TestNotifierPublishesServiceStateChanges(t *testing.T) {
+	notifier := NewNotifier("test")
+	defer notifier.stop()
+	sink := NewTestSink()
+	notifier.addSink(sink, NotificationFilter{})
+
+	service := Service{Name: "foo-service-1", Categories: []string{"default", "read"}}
+	notifier.observeService(service, measured(fthealth.CheckResult{Name: service.Name, Ok: true, Severity: 2}))
+	notifier.observeService(service, measured(fthealth.CheckResult{Name: service.Name, Ok: true, Severity: 2}))
+	sink.assertNothingSent(t)
+
+	notifier.observeService(service, measured(fthealth.CheckResult{Name: service.Name, Ok: false, Severity: 2, Output: "broken"}))
+	n := sink.next(t)
+	assert.Equal(t, serviceStateChanged, n.Event)
+	assert.Equal(t, "test", n.Environment)
+	assert.Equal(t, "foo-service-1", n.Service)
+	assert.Equal(t, []string{"default", "read"}, n.Categories)
+	assert.False(t, n.Ok)
+	assert.Equal(t, "broken", n.Output)
+
+	notifier.observeService(service, measured(fthealth.CheckResult{Name: service.Name, Ok: false, Severity: 2, Ack: "looking into it"}))
+	n = sink.next(t)
+	assert.Equal(t, serviceAcked, n.Event)
+	assert.Equal(t, "looking into it", n.Ack)
+	sink.assertNothingSent(t)
+}
+
+func TestNotifierPublishesFailingInnerChecks(t *testing.T) {
+	notifier := NewNotifier("test")
+	defer notifier.stop()
+	sink := NewTestSink()
+	notifier.addSink(sink, NotificationFilter{})
+	health := &healthcheckResponse{Checks: []check{{Name: "db", CheckOutput: "connection refused"}, {Name: "cache", OK: true}, {Name: "queue"}}}
+
+	service := Service{Name: "foo-service-1"}
+	notifier.observeService(service, measured(fthealth.CheckResult{Name: service.Name, Ok: true, Severity: 2}))
+	notifier.observeService(service, MeasuredHealth{
+		HealthResult: fthealth.HealthResult{Checks: []fthealth.CheckResult{{Name: service.Name, Ok: false, Severity: 2}}},
+		Healthcheck:  health,
+	})
+
+	n := sink.next(t)
+	assert.Equal(t, []check{{Name: "db", CheckOutput: "connection refused"}, {Name: "queue"}}, n.FailingChecks)
+	assert.Equal(t, "db: connection refused\nqueue", n.failingChecksSummary())
+}
+
+func TestNotifierRecoveryReachesSinksOfTheFailure(t *testing.T) {
+	notifier := NewNotifier("test")
+	defer notifier.stop()
+	sink := NewTestSink()
+	notifier.addSink(sink, NotificationFilter{MinSeverity: 1})
+
+	service := Service{Name: "foo-service-1"}
+	notifier.observeService(service, measured(fthealth.CheckResult{Name: service.Name, Ok: true, Severity: 2}))
+	notifier.observeService(service, measured(fthealth.CheckResult{Name: service.Name, Ok: false, Severity: 1}))
+	assert.Equal(t, uint8(1), sink.next(t).Severity)
+
+	notifier.observeService(service, measured(fthealth.CheckResult{Name: service.Name, Ok: true, Severity: 2}))
+	n := sink.next(t)
+	assert.True(t, n.Ok)
+	assert.Equal(t, uint8(1), n.Severity, "the recovery has the severity of the failure it resolves")
+
+	notifier.observeService(service, measured(fthealth.CheckResult{Name: service.Name, Ok: false, Severity: 2}))
+	notifier.observeService(service, measured(fthealth.CheckResult{Name: service.Name, Ok: true, Severity: 2}))
+	sink.assertNothingSent(t)
+}
+
+func TestNotifierPublishesSlowServices(t *testing.T) {
+	notifier := NewNotifier("test")
+	defer notifier.stop()
+	sink := NewTestSink()
+	notifier.addSink(sink, NotificationFilter{})
+
+	service := Service{Name: "foo-service-1"}
+	notifier.observeService(service, measured(fthealth.CheckResult{Name: service.Name, Ok: true, Severity: 1}))
+	slow := measured(fthealth.CheckResult{Name: service.Name, Ok: true, Severity: slowCheckSeverity, Output: "SLOW - took 4s, over the 3s threshold"})
+	slow.Slow = true
+	notifier.observeService(service, slow)
+
+	n := sink.next(t)
+	assert.Equal(t, serviceStateChanged, n.Event)
+	assert.True(t, n.Ok)
+	assert.True(t, n.Slow)
+	assert.Equal(t, uint8(slowCheckSeverity), n.Severity)
+	assert.Equal(t, "foo-service-1 is healthy but slow in test", n.summary())
+
+	notifier.observeService(service, slow)
+	sink.assertNothingSent(t)
+
+	notifier.observeService(service, measured(fthealth.CheckResult{Name: service.Name, Ok: true, Severity: 1}))
+	n = sink.next(t)
+	assert.False(t, n.Slow)
+	assert.Equal(t, "foo-service-1 is healthy in test", n.summary())
+}
+
+func TestNotifierPublishesClusterAckChanges(t *testing.T) {
+	notifier := NewNotifier("test")
+	defer notifier.stop()
+	sink := NewTestSink()
+	notifier.addSink(sink, NotificationFilter{})
+
+	notifier.observeClusterAck("")
+	sink.assertNothingSent(t)
+
+	notifier.observeClusterAck("maintenance")
+	n := sink.next(t)
+	assert.Equal(t, clusterAcked, n.Event)
+	assert.Equal(t, "maintenance", n.ClusterAck)
+
+	notifier.observeClusterAck("")
+	n = sink.next(t)
+	assert.Equal(t, clusterAckRemoved, n.Event)
+}
+
+func TestNotificationFilter(t *testing.T) {
+	filter := NotificationFilter{Categories: []string{"read"}, MinSeverity: 1}
+
+	assert.True(t, filter.matches(Notification{Categories: []string{"default", "read"}, Severity: 1}))
+	assert.False(t, filter.matches(Notification{Categories: []string{"default", "read"}, Severity: 2}), "severity 2 is below the minimum")
+	assert.False(t, filter.matches(Notification{Categories: []string{"default", "publish"}, Severity: 1}), "category is not watched")
+	assert.True(t, filter.matches(Notification{Event: clusterAcked}), "cluster wide notifications always match")
+}
+
+func TestDisableCategoryIfStickyNotifies(t *testing.T) {
+	stickyNode := client.Node{Key: "/ft/healthcheck-categories/foo/sticky", Value: "true"}
+	etcd := TestEtcdKeysAPI{&client.Response{Node: &stickyNode}, nil}
+
+	registry := NewCocoServiceRegistry(etcd, "127.0.0.1", nil, "test")
+	registry.notifier = NewNotifier("test")
+	defer registry.notifier.stop()
+	sink := NewTestSink()
+	registry.notifier.addSink(sink, NotificationFilter{})
+
+	registry.disableCategoryIfSticky("foo")
+
+	n := sink.next(t)
+	assert.Equal(t, categoryDisabled, n.Event)
+	assert.Equal(t, "foo", n.Category)
+}
+
+func TestWebhookDeliveryWithRetries(t *testing.T) {
+	var lock sync.Mutex
+	var calls int
+	received := make(chan Notification, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		calls++
+		first := calls == 1
+		lock.Unlock()
+		if first {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var n Notification
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&n))
+		received <- n
+	}))
+	defer server.Close()
+
+	notifier := NewNotifier("test")
+	defer notifier.stop()
+	delivery := notifier.addSink(NewWebhookSink(server.URL, http.DefaultClient), NotificationFilter{})
+	delivery.retryInterval = 10 * time.Millisecond
+
+	notifier.categoryDisabled("foo")
+
+	select {
+	case n := <-received:
+		assert.Equal(t, categoryDisabled, n.Event)
+		assert.Equal(t, "foo", n.Category)
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook was not called")
+	}
+
+	status := waitForDelivery(t, notifier)
+	assert.Equal(t, 1, status.Delivered)
+	assert.Equal(t, 1, status.Retried)
+	assert.Equal(t, 0, status.Failed)
+	assert.Contains(t, status.LastError, "500")
+}
+
+func TestHandleDeliveryStatus(t *testing.T) {
+	notifier := NewNotifier("test")
+	defer notifier.stop()
+	delivery := notifier.addSink(failingSink{}, NotificationFilter{})
+	delivery.maxAttempts = 1
+
+	notifier.categoryDisabled("foo")
+	waitForAttempt(t, delivery)
+
+	req, _ := http.NewRequest("GET", "http://www.example.com/__notifications", nil)
+	w := httptest.NewRecorder()
+	notifier.handleDeliveryStatus(w, req)
+
+	var statuses []DeliveryStatus
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&statuses))
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, "failing", statuses[0].Sink)
+	assert.Equal(t, 1, statuses[0].Failed)
+	assert.Equal(t, "unreachable", statuses[0].LastError)
+}
+
+type failingSink struct{}
+
+func (failingSink) Name() string {
+	return "failing"
+}
+
+func (failingSink) Send(n Notification) error {
+	return errors.New("unreachable")
+}
+
+func waitForDelivery(t *testing.T, notifier *Notifier) DeliveryStatus {
+	for i := 0; i < 100; i++ {
+		status := notifier.deliveryStatuses()[0]
+		if status.Delivered+status.Failed > 0 {
+			return status
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("notification was not delivered")
+	return DeliveryStatus{}
+}
+
+func waitForAttempt(t *testing.T, delivery *sinkDelivery) {
+	for i := 0; i < 100; i++ {
+		if delivery.currentStatus().LastAttempt != nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("notification delivery was not attempted")
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"time"
+)
+
+const (
+	serviceEscalated  = "service-escalated"
+	categoryEscalated = "category-escalated"
+)
+
+// NotificationPolicy is how notifications about services or categories get throttled and escalated,
+// as configured for their categories.
+type NotificationPolicy struct {
+	// Interval is the minimum time between two notifications about the same subject to the same sink.
+	// Notifications arriving sooner are coalesced, and only the latest is sent once the interval passed.
+	Interval time.Duration
+	// EscalationPeriod is how long a warning can persist before it gets escalated as critical.
+	EscalationPeriod time.Duration
+}
+
+// policyFor combines the policies of the given categories, using the longest interval and the
+// shortest escalation period configured.
+func (n *Notifier) policyFor(categoryNames []string) NotificationPolicy {
+	var policy NotificationPolicy
+	if n.registry == nil || len(categoryNames) == 0 {
+		return policy
+	}
+	categories := n.registry.categories()
+	for _, name := range categoryNames {
+		category, found := categories[name]
+		if !found {
+			continue
+		}
+		if category.NotificationInterval > policy.Interval {
+			policy.Interval = category.NotificationInterval
+		}
+		if category.EscalationPeriod > 0 && (policy.EscalationPeriod == 0 || category.EscalationPeriod < policy.EscalationPeriod) {
+			policy.EscalationPeriod = category.EscalationPeriod
+		}
+	}
+	return policy
+}
+
+// throttleKey groups the notifications that supersede each other, e.g. a service becoming healthy
+// supersedes it becoming unhealthy, but not it being acked.
+func (n Notification) throttleKey() string {
+	switch n.Event {
+	case serviceStateChanged, serviceEscalated:
+		return "service/" + n.Service + "/state"
+	case serviceAcked, serviceAckRemoved:
+		return "service/" + n.Service + "/ack"
+	case categoryStateChanged, categoryEscalated:
+		return "category/" + n.Category + "/state"
+	case categoryDisabled:
+		return "category/" + n.Category + "/disabled"
+	}
+	return "cluster/ack"
+}
+
+// repeats is true if the notification reports the same state as the previous one. Disabling a
+// category has no counterpart notification, so it never counts as repeated.
+func (n Notification) repeats(previous Notification) bool {
+	return n.Event != categoryDisabled &&
+		n.Event == previous.Event &&
+		n.Ok == previous.Ok &&
+		n.Slow == previous.Slow &&
+		n.Severity == previous.Severity &&
+		n.Ack == previous.Ack
+}
+
+type throttledSubject struct {
+	last     *Notification
+	lastTime time.Time
+	pending  *Notification
+}
+
+// offer queues the notification for delivery, unless it repeats the last one delivered about the same subject,
+// or the interval since that one hasn't passed yet, in which case it waits for the end of the interval.
+func (d *sinkDelivery) offer(notification Notification, interval time.Duration) {
+	key := notification.throttleKey()
+
+	d.Lock()
+	subject, found := d.subjects[key]
+	if !found {
+		subject = &throttledSubject{}
+		d.subjects[key] = subject
+	}
+	if subject.last != nil && notification.repeats(*subject.last) {
+		subject.pending = nil
+		d.status.Deduplicated++
+		d.Unlock()
+		return
+	}
+	if wait := interval - time.Since(subject.lastTime); subject.last != nil && wait > 0 {
+		if subject.pending == nil {
+			time.AfterFunc(wait, func() {
+				d.releasePending(key)
+			})
+		}
+		subject.pending = &notification
+		d.status.Throttled++
+		d.Unlock()
+		return
+	}
+	subject.last = &notification
+	subject.lastTime = time.Now()
+	d.Unlock()
+
+	d.enqueue(notification)
+}
+
+func (d *sinkDelivery) releasePending(key string) {
+	d.Lock()
+	subject := d.subjects[key]
+	pending := subject.pending
+	subject.pending = nil
+	if pending == nil || pending.repeats(*subject.last) {
+		d.Unlock()
+		return
+	}
+	subject.last = pending
+	subject.lastTime = time.Now()
+	d.Unlock()
+
+	d.enqueue(*pending)
+}
+
+type escalation struct {
+	timer        *time.Timer
+	notification Notification
+	escalated    bool
+}
+
+// trackEscalation escalates the subject of the notification once it's been reporting a warning for
+// longer than its escalation period. It's called with every fresh state of the subject.
+func (n *Notifier) trackEscalation(notification Notification, escalatedEvent string) {
+	key := notification.throttleKey()
+	warning := !notification.Ok && notification.Ack == "" && notification.Severity > 1
+	period := n.policyFor(notification.Categories).EscalationPeriod
+
+	n.Lock()
+	defer n.Unlock()
+	current, found := n.escalations[key]
+	if !warning {
+		if found {
+			current.timer.Stop()
+			delete(n.escalations, key)
+		}
+		return
+	}
+	if found {
+		current.notification = notification
+		return
+	}
+	if period == 0 {
+		return
+	}
+	esc := &escalation{notification: notification}
+	esc.timer = time.AfterFunc(period, func() {
+		n.escalate(key, esc, escalatedEvent, period)
+	})
+	n.escalations[key] = esc
+}
+
+func (n *Notifier) escalate(key string, esc *escalation, escalatedEvent string, period time.Duration) {
+	n.Lock()
+	if n.escalations[key] != esc || esc.escalated {
+		n.Unlock()
+		return
+	}
+	if n.clusterAck != nil && *n.clusterAck != "" {
+		// try again once the cluster isn't acked anymore
+		delete(n.escalations, key)
+		n.Unlock()
+		return
+	}
+	esc.escalated = true
+	notification := esc.notification
+	n.Unlock()
+
+	infoLogger.Printf("Escalating %v as it has been failing for more than %v.", key, period)
+	notification.Event = escalatedEvent
+	notification.Severity = 1
+	// for the recovery to reach the sinks only listening to critical notifications too
+	n.trackFailureSeverity(&notification)
+	n.publish(notification)
+}
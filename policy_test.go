@@ -0,0 +1,131 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	fthealth "github.com/Financial-Times/go-fthealth/v1a"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPolicyTestNotifier(category Category) (*Notifier, *TestSink, *sinkDelivery) {
+	registry := new(MockRegistry)
+	registry.On("categories").Return(map[string]Category{category.Name: category})
+
+	notifier := NewNotifier("test")
+	notifier.registry = registry
+	sink := NewTestSink()
+	delivery := notifier.addSink(sink, NotificationFilter{})
+	return notifier, sink, delivery
+}
+
+func TestNotifierDeduplicatesRepeatedStates(t *testing.T) {
+	notifier, sink, delivery := newPolicyTestNotifier(Category{Name: "read"})
+	defer notifier.stop()
+
+	unhealthy := Notification{Event: serviceStateChanged, Service: "foo-service-1", Categories: []string{"read"}, Severity: 2}
+	notifier.publish(unhealthy)
+	assert.Equal(t, serviceStateChanged, sink.next(t).Event)
+
+	notifier.publish(unhealthy)
+	sink.assertNothingSent(t)
+	assert.Equal(t, 1, delivery.currentStatus().Deduplicated)
+
+	notifier.publish(Notification{Event: serviceAcked, Service: "foo-service-1", Categories: []string{"read"}, Severity: 2, Ack: "on it"})
+	assert.Equal(t, serviceAcked, sink.next(t).Event, "acks are not superseded by state changes")
+}
+
+func TestNotifierSendsServicesGettingFastAgain(t *testing.T) {
+	notifier, sink, delivery := newPolicyTestNotifier(Category{Name: "read"})
+	defer notifier.stop()
+
+	service := Service{Name: "foo-service-1", Categories: []string{"read"}}
+	slow := measured(fthealth.CheckResult{Name: service.Name, Ok: true, Severity: 2})
+	slow.Slow = true
+	notifier.observeService(service, measured(fthealth.CheckResult{Name: service.Name, Ok: true, Severity: 2}))
+	notifier.observeService(service, slow)
+	n := sink.next(t)
+	assert.True(t, n.Ok)
+	assert.True(t, n.Slow)
+
+	notifier.observeService(service, measured(fthealth.CheckResult{Name: service.Name, Ok: true, Severity: 2}))
+	n = sink.next(t)
+	assert.True(t, n.Ok)
+	assert.False(t, n.Slow, "getting fast again is not a repeat of getting slow")
+	assert.Equal(t, 0, delivery.currentStatus().Deduplicated)
+}
+
+func TestNotifierThrottlesFlappingServices(t *testing.T) {
+	notifier, sink, delivery := newPolicyTestNotifier(Category{Name: "read", NotificationInterval: 200 * time.Millisecond})
+	defer notifier.stop()
+
+	unhealthy := Notification{Event: serviceStateChanged, Service: "foo-service-1", Categories: []string{"read"}, Severity: 2}
+	healthy := Notification{Event: serviceStateChanged, Service: "foo-service-1", Categories: []string{"read"}, Severity: 2, Ok: true}
+
+	notifier.publish(unhealthy)
+	assert.False(t, sink.next(t).Ok)
+
+	notifier.publish(healthy)
+	notifier.publish(unhealthy)
+	sink.assertNothingSent(t)
+	time.Sleep(200 * time.Millisecond)
+	sink.assertNothingSent(t)
+	assert.Equal(t, 1, delivery.currentStatus().Throttled)
+	assert.Equal(t, 1, delivery.currentStatus().Deduplicated, "flapping back cancels the pending notification")
+
+	notifier.publish(healthy)
+	n := sink.next(t)
+	assert.True(t, n.Ok, "notifications are sent right away once the interval passed")
+}
+
+func TestNotifierSendsLatestThrottledState(t *testing.T) {
+	notifier, sink, _ := newPolicyTestNotifier(Category{Name: "read", NotificationInterval: 200 * time.Millisecond})
+	defer notifier.stop()
+
+	notifier.publish(Notification{Event: serviceStateChanged, Service: "foo-service-1", Categories: []string{"read"}, Severity: 2})
+	assert.False(t, sink.next(t).Ok)
+
+	notifier.publish(Notification{Event: serviceStateChanged, Service: "foo-service-1", Categories: []string{"read"}, Severity: 2, Ok: true})
+	sink.assertNothingSent(t)
+	n := sink.next(t)
+	assert.True(t, n.Ok, "the latest state is sent once the interval passed")
+}
+
+func TestNotifierEscalatesPersistingWarnings(t *testing.T) {
+	notifier, sink, _ := newPolicyTestNotifier(Category{Name: "read", EscalationPeriod: 100 * time.Millisecond})
+	defer notifier.stop()
+
+	service := Service{Name: "foo-service-1", Categories: []string{"read"}}
+	notifier.observeService(service, measured(fthealth.CheckResult{Name: service.Name, Ok: true, Severity: 2}))
+	notifier.observeService(service, measured(fthealth.CheckResult{Name: service.Name, Ok: false, Severity: 2, Output: "broken"}))
+	n := sink.next(t)
+	assert.Equal(t, serviceStateChanged, n.Event)
+	assert.Equal(t, uint8(2), n.Severity)
+
+	n = sink.next(t)
+	assert.Equal(t, serviceEscalated, n.Event)
+	assert.Equal(t, uint8(1), n.Severity)
+	assert.Equal(t, "broken", n.Output)
+
+	notifier.observeService(service, measured(fthealth.CheckResult{Name: service.Name, Ok: false, Severity: 2, Output: "broken"}))
+	sink.assertNothingSent(t)
+
+	notifier.observeService(service, measured(fthealth.CheckResult{Name: service.Name, Ok: true, Severity: 2}))
+	n = sink.next(t)
+	assert.Equal(t, serviceStateChanged, n.Event)
+	assert.True(t, n.Ok)
+	assert.Equal(t, uint8(1), n.Severity, "the recovery of an escalated warning is critical too")
+}
+
+func TestNotifierDoesNotEscalateAckedWarnings(t *testing.T) {
+	notifier, sink, _ := newPolicyTestNotifier(Category{Name: "read", EscalationPeriod: 100 * time.Millisecond})
+	defer notifier.stop()
+
+	service := Service{Name: "foo-service-1", Categories: []string{"read"}}
+	notifier.observeService(service, measured(fthealth.CheckResult{Name: service.Name, Ok: false, Severity: 2}))
+	notifier.observeService(service, measured(fthealth.CheckResult{Name: service.Name, Ok: false, Severity: 2, Ack: "on it"}))
+	assert.Equal(t, serviceAcked, sink.next(t).Event)
+
+	time.Sleep(150 * time.Millisecond)
+	sink.assertNothingSent(t)
+}
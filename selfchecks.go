@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	fthealth "github.com/Financial-Times/go-fthealth/v1a"
+)
+
+const (
+	selfCheckPrefix     = "aggregate-healthcheck-"
+	selfCheckPanicGuide = "https://github.com/Financial-Times/aggregate-healthcheck"
+	watcherErrorWindow  = time.Minute
+	maxSchedulerLag     = 30 * time.Second
+	maxSinkBacklogRate  = 0.5
+)
+
+// AggregatorHealth keeps track of the state of the dependencies of the aggregator itself,
+// to be reported along with the services it checks.
+type AggregatorHealth struct {
+	sync.Mutex
+	etcdErrors     map[string]error
+	watcherErrors  map[string]time.Time
+	sinksConnected map[string]bool
+	sinksPending   map[string]int
+	sinksCapacity  map[string]int
+	schedulerLags  map[string]time.Duration
+}
+
+func NewAggregatorHealth() *AggregatorHealth {
+	return &AggregatorHealth{
+		etcdErrors:     make(map[string]error),
+		watcherErrors:  make(map[string]time.Time),
+		sinksConnected: make(map[string]bool),
+		sinksPending:   make(map[string]int),
+		sinksCapacity:  make(map[string]int),
+		schedulerLags:  make(map[string]time.Duration),
+	}
+}
+
+var selfHealth = NewAggregatorHealth()
+
+// etcdRead records the outcome of the latest read of the given etcd target.
+func (h *AggregatorHealth) etcdRead(target string, err error) {
+	h.Lock()
+	defer h.Unlock()
+	h.etcdErrors[target] = err
+}
+
+func (h *AggregatorHealth) watcherFailed(target string) {
+	h.Lock()
+	defer h.Unlock()
+	h.watcherErrors[target] = time.Now()
+}
+
+func (h *AggregatorHealth) sinkConnection(sink string, connected bool) {
+	h.Lock()
+	defer h.Unlock()
+	h.sinksConnected[sink] = connected
+}
+
+// sinkBacklog records how many metrics are waiting to be sent by the metrics sink, out of how many it can keep.
+func (h *AggregatorHealth) sinkBacklog(sink string, pending int, capacity int) {
+	h.Lock()
+	defer h.Unlock()
+	h.sinksPending[sink] = pending
+	h.sinksCapacity[sink] = capacity
+}
+
+// checkStarted records how late the scheduled check of the service started.
+func (h *AggregatorHealth) checkStarted(service string, lag time.Duration) {
+	h.Lock()
+	defer h.Unlock()
+	h.schedulerLags[service] = lag
+}
+
+// checks are the checks of the aggregator itself, the scheduler lag being measured over the services
+// currently in the registry.
+func (h *AggregatorHealth) checks(registry ServiceRegistry) []fthealth.Check {
+	return []fthealth.Check{
+		{
+			Name:             selfCheckPrefix + "etcd",
+			BusinessImpact:   "No direct business impact, but changes to the monitored services, categories and acks are not picked up.",
+			TechnicalSummary: "The aggregator can't read its configuration from etcd. Check the etcd cluster and the etcd-peers setting of the aggregator.",
+			PanicGuide:       selfCheckPanicGuide,
+			Severity:         2,
+			Checker:          h.checkEtcd,
+		},
+		{
+			Name:             selfCheckPrefix + "etcd-watchers",
+			BusinessImpact:   "No direct business impact, but changes to the monitored services, categories and acks are not picked up.",
+			TechnicalSummary: fmt.Sprintf("The aggregator failed watching etcd for changes in the last %v. Check the etcd cluster.", watcherErrorWindow),
+			PanicGuide:       selfCheckPanicGuide,
+			Severity:         2,
+			Checker:          h.checkWatchers,
+		},
+		{
+			Name:             selfCheckPrefix + "metrics-sinks",
+			BusinessImpact:   "No direct business impact, but the availability history of the services is not recorded.",
+			TechnicalSummary: "The aggregator is not connected to one of its metrics backends, like Graphite. Check the backend and the settings of the aggregator pointing to it.",
+			PanicGuide:       selfCheckPanicGuide,
+			Severity:         2,
+			Checker:          h.checkSinks,
+		},
+		{
+			Name:             selfCheckPrefix + "metrics-backlog",
+			BusinessImpact:   "No direct business impact, but gaps appear in the availability history of the services once the backlog is full.",
+			TechnicalSummary: "Metrics are piling up in memory, waiting to be sent to one of the metrics backends. Check the connection to the backend, or enable the Graphite spool.",
+			PanicGuide:       selfCheckPanicGuide,
+			Severity:         2,
+			Checker:          h.checkSinksBacklog,
+		},
+		{
+			Name:             selfCheckPrefix + "scheduler",
+			BusinessImpact:   "No direct business impact, but the cached health of the services gets out of date.",
+			TechnicalSummary: fmt.Sprintf("Scheduled service checks start more than %v late. The aggregator may be short of resources.", maxSchedulerLag),
+			PanicGuide:       selfCheckPanicGuide,
+			Severity:         2,
+			Checker: func() (string, error) {
+				return h.checkSchedulerLag(registry)
+			},
+		},
+	}
+}
+
+func (h *AggregatorHealth) checkEtcd() (string, error) {
+	h.Lock()
+	defer h.Unlock()
+	var failures []string
+	for target, err := range h.etcdErrors {
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%v: %v", target, err.Error()))
+		}
+	}
+	if len(failures) > 0 {
+		sort.Strings(failures)
+		return "", fmt.Errorf("Failed to read from etcd (%v)", strings.Join(failures, "; "))
+	}
+	return "etcd is reachable", nil
+}
+
+func (h *AggregatorHealth) checkWatchers() (string, error) {
+	h.Lock()
+	defer h.Unlock()
+	var failing []string
+	for target, failed := range h.watcherErrors {
+		if time.Since(failed) < watcherErrorWindow {
+			failing = append(failing, target)
+		}
+	}
+	if len(failing) > 0 {
+		sort.Strings(failing)
+		return "", fmt.Errorf("Watchers failing: %v", strings.Join(failing, ", "))
+	}
+	return "etcd watchers are up to date", nil
+}
+
+func (h *AggregatorHealth) checkSinks() (string, error) {
+	h.Lock()
+	defer h.Unlock()
+	var connected, disconnected []string
+	for sink, ok := range h.sinksConnected {
+		if ok {
+			connected = append(connected, sink)
+		} else {
+			disconnected = append(disconnected, sink)
+		}
+	}
+	sort.Strings(connected)
+	sort.Strings(disconnected)
+	if len(disconnected) > 0 {
+		return "", fmt.Errorf("Not connected to %v", strings.Join(disconnected, ", "))
+	}
+	return fmt.Sprintf("Connected to %v", strings.Join(connected, ", ")), nil
+}
+
+func (h *AggregatorHealth) checkSinksBacklog() (string, error) {
+	h.Lock()
+	defer h.Unlock()
+	var backlogged []string
+	total := 0
+	for sink, pending := range h.sinksPending {
+		total += pending
+		if capacity := h.sinksCapacity[sink]; capacity > 0 && float64(pending) > maxSinkBacklogRate*float64(capacity) {
+			backlogged = append(backlogged, fmt.Sprintf("%v: %d out of %d", sink, pending, capacity))
+		}
+	}
+	if len(backlogged) > 0 {
+		sort.Strings(backlogged)
+		return "", fmt.Errorf("Metrics waiting to be sent (%v)", strings.Join(backlogged, ", "))
+	}
+	return fmt.Sprintf("%d metrics waiting to be sent", total), nil
+}
+
+func (h *AggregatorHealth) checkSchedulerLag(registry ServiceRegistry) (string, error) {
+	h.Lock()
+	defer h.Unlock()
+	var maxLag time.Duration
+	for name := range registry.measuredServices() {
+		if lag := h.schedulerLags[name]; lag > maxLag {
+			maxLag = lag
+		}
+	}
+	if maxLag > maxSchedulerLag {
+		return "", fmt.Errorf("Service checks start up to %v late", maxLag)
+	}
+	return fmt.Sprintf("Service checks start up to %v late", maxLag), nil
+}
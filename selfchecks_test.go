@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	fthealth "github.com/Financial-Times/go-fthealth/v1a"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelfChecksHealthy(t *testing.T) {
+	registry := new(MockRegistry)
+	registry.On("measuredServices").Return(map[string]MeasuredService{"foo-service-1": NewMeasuredService(&Service{Name: "foo-service-1"})})
+
+	h := NewAggregatorHealth()
+	h.etcdRead("services", nil)
+	h.sinkConnection("graphite graphite:2003", true)
+	h.sinkBacklog("graphite graphite:2003", 10, 100)
+	h.checkStarted("foo-service-1", time.Second)
+
+	for _, check := range fthealth.RunCheck("self", "", false, h.checks(registry)...).Checks {
+		assert.True(t, check.Ok, check.Name)
+	}
+}
+
+func TestSelfChecksUnhealthy(t *testing.T) {
+	registry := new(MockRegistry)
+	registry.On("measuredServices").Return(map[string]MeasuredService{"foo-service-1": NewMeasuredService(&Service{Name: "foo-service-1"})})
+
+	h := NewAggregatorHealth()
+	h.etcdRead("services", errors.New("connection refused"))
+	h.watcherFailed("categories")
+	h.sinkConnection("graphite graphite:2003", false)
+	h.sinkConnection("graphite graphite-eu:2003", true)
+	h.sinkBacklog("graphite graphite:2003", 80, 100)
+	h.checkStarted("foo-service-1", time.Minute)
+	h.checkStarted("removed-service-1", time.Hour)
+
+	results := make(map[string]fthealth.CheckResult)
+	for _, check := range fthealth.RunCheck("self", "", false, h.checks(registry)...).Checks {
+		results[check.Name] = check
+	}
+	assert.False(t, results["aggregate-healthcheck-etcd"].Ok)
+	assert.Contains(t, results["aggregate-healthcheck-etcd"].Output, "services: connection refused")
+	assert.False(t, results["aggregate-healthcheck-etcd-watchers"].Ok)
+	assert.False(t, results["aggregate-healthcheck-metrics-sinks"].Ok)
+	assert.Contains(t, results["aggregate-healthcheck-metrics-sinks"].Output, "graphite graphite:2003")
+	assert.NotContains(t, results["aggregate-healthcheck-metrics-sinks"].Output, "graphite-eu:2003")
+	assert.False(t, results["aggregate-healthcheck-metrics-backlog"].Ok)
+	assert.False(t, results["aggregate-healthcheck-scheduler"].Ok)
+	assert.Contains(t, results["aggregate-healthcheck-scheduler"].Output, "1m0s", "removed services are ignored")
+}
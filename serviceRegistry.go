@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	"context"
@@ -27,13 +28,29 @@ const (
 	categoriesSuffix    = "/categories"
 	ackSuffix           = "/ack"
 	stickySuffix        = "/sticky"
+	slackChannelSuffix  = "/slack_channel"
+	recipientsSuffix    = "/email_recipients"
+	notificationSuffix  = "/notification_interval_seconds"
+	escalationSuffix    = "/escalation_seconds"
+	summaryTplSuffix    = "/technical_summary_template"
+	panicGuideTplSuffix = "/panic_guide_template"
+	checkTypeSetting    = "type"
+	severitySetting     = "severity"
+	impactSetting       = "business_impact"
+	panicGuideSetting   = "panic_guide"
+	teamSetting         = "team"
+	systemCodeSetting   = "system_code"
+	timeoutSetting      = "timeout_seconds"
+	headersSetting      = "headers/"
+	statusSetting       = "expected_status"
+	hostHeaderSetting   = "host_header"
 	defaultDuration     = time.Duration(60 * time.Second)
 	pathPre             = "/health/%s%s"
 	defaultPath         = "/__health"
 	defaultCategoryName = "default"
 )
 
-var defaultCategory = Category{defaultCategoryName, time.Second * 60, false, true, false}
+var defaultCategory = Category{Name: defaultCategoryName, Period: time.Second * 60, Enabled: true}
 
 type Service struct {
 	Name        string
@@ -43,14 +60,41 @@ type Service struct {
 	Categories  []string
 	Ack         string
 	ServiceKey  string
+	// how long to wait for the healthcheck, the default timeout of the checker if zero
+	Timeout time.Duration
+	// extra headers of the healthcheck request
+	Headers map[string]string
+	// status codes of a successful healthcheck response, 200 only if empty
+	ExpectedStatuses []int
+	// Host header of the healthcheck request, the name of the service if empty
+	HostHeader string
+	// type of the checks of the service, ft-json if empty
+	CheckType string
+	// every key of the etcd directory of the service, relative to it, for the check type to read its settings from
+	Settings map[string]string
+	// severity of the failures of the service, 2 or 1 for the severity 1 apps if zero
+	Severity       uint8
+	BusinessImpact string
+	PanicGuide     string
+	Team           string
+	SystemCode     string
 }
 
 type Category struct {
-	Name        string
-	Period      time.Duration
-	IsResilient bool
-	Enabled     bool
-	Sticky      bool
+	Name            string
+	Period          time.Duration
+	IsResilient     bool
+	Enabled         bool
+	Sticky          bool
+	SlackChannel    string
+	EmailRecipients []string
+	// minimum time between notifications about the same service or category
+	NotificationInterval time.Duration
+	// time after which an unhealthy service or category gets escalated as critical, if set
+	EscalationPeriod time.Duration
+	// templates overriding the technical summary and the panic guide of the checks of the services of the category, if set
+	TechnicalSummaryTemplate *template.Template
+	PanicGuideTemplate       *template.Template
 }
 
 type MeasuredService struct {
@@ -74,11 +118,13 @@ type ServiceRegistry interface {
 	areResilient([]string) bool
 	measuredServices() map[string]MeasuredService
 	checker() HealthChecker
+	slowThreshold() time.Duration
+	checkDoc(Service) checkDoc
 	getServiceAck(string) string
 	disableCategoryIfSticky(string)
 	categories() map[string]Category
 	clusterAck() string
-	updateCachedAndBufferedHealth(*MeasuredService, *fthealth.HealthResult)
+	updateCachedAndBufferedHealth(*MeasuredService, *MeasuredHealth)
 }
 
 type EtcdServiceRegistry struct {
@@ -92,6 +138,9 @@ type EtcdServiceRegistry struct {
 	_measuredServices map[string]MeasuredService
 	_clusterAck       string
 	environment       string
+	notifier          *Notifier
+	docs              *CheckDocs
+	_slowThreshold    time.Duration
 }
 
 type EtcdHealthCheckKeysAPI interface {
@@ -104,7 +153,7 @@ func NewCocoServiceRegistry(etcd EtcdHealthCheckKeysAPI, vulcandAddr string, che
 	services := make(map[string]Service)
 	categories := make(map[string]Category)
 	measuredServices := make(map[string]MeasuredService)
-	return &EtcdServiceRegistry{sync.Mutex{}, etcd, time.Duration(60) * time.Second, vulcandAddr, checker, services, categories, measuredServices, "", environment}
+	return &EtcdServiceRegistry{sync.Mutex{}, etcd, time.Duration(60) * time.Second, vulcandAddr, checker, services, categories, measuredServices, "", environment, nil, defaultCheckDocs, 0}
 }
 
 func (r *EtcdServiceRegistry) measuredServices() map[string]MeasuredService {
@@ -115,6 +164,15 @@ func (r *EtcdServiceRegistry) checker() HealthChecker {
 	return r._checker
 }
 
+func (r *EtcdServiceRegistry) slowThreshold() time.Duration {
+	return r._slowThreshold
+}
+
+// checkDoc is the technical summary and panic guide of the check of the service, rendered for its categories.
+func (r *EtcdServiceRegistry) checkDoc(service Service) checkDoc {
+	return r.docs.render(service, r.categories())
+}
+
 func (r *EtcdServiceRegistry) categories() map[string]Category {
 	r.Lock()
 	defer r.Unlock()
@@ -138,6 +196,8 @@ func (r *EtcdServiceRegistry) watchClusterAck() {
 		_, err := watcher.Next(context.Background())
 		if err != nil {
 			errorLogger.Printf("Error waiting for change under %v in etcd. %v\n Sleeping 10s...", clusterAckEtcdKey, err.Error())
+			selfMetrics.etcdErrors.inc("cluster-ack")
+			selfHealth.watcherFailed("cluster-ack")
 			time.Sleep(10 * time.Second)
 			continue
 		}
@@ -147,17 +207,24 @@ func (r *EtcdServiceRegistry) watchClusterAck() {
 
 func (r *EtcdServiceRegistry) redefineClusterAck() {
 	infoLogger.Print("Reloading cluster ack")
+	selfMetrics.etcdReloads.inc("cluster-ack")
 	clusterAckResp, err := r.etcd.Get(context.Background(), clusterAckEtcdKey, &client.GetOptions{Sort: true})
+	selfHealth.etcdRead("cluster-ack", err)
 
 	r.Lock()
-	defer r.Unlock()
 	if err != nil {
 		r._clusterAck = ""
+		selfMetrics.etcdErrors.inc("cluster-ack")
 		errorLogger.Printf("Failed to get value from %v: %v. Removing cluster ack message.", clusterAckEtcdKey, err.Error())
-		return
+	} else {
+		r._clusterAck = clusterAckResp.Node.Value
 	}
+	clusterAck := r._clusterAck
+	r.Unlock()
 
-	r._clusterAck = clusterAckResp.Node.Value
+	if r.notifier != nil {
+		r.notifier.observeClusterAck(clusterAck)
+	}
 }
 
 func (r *EtcdServiceRegistry) watchServices() {
@@ -170,6 +237,8 @@ func (r *EtcdServiceRegistry) watchServices() {
 		_, err := watcher.Next(context.Background())
 		if err != nil {
 			errorLogger.Printf("Error waiting for change under %v in etcd. %v\n Sleeping 10s...", servicesKeyPre, err.Error())
+			selfMetrics.etcdErrors.inc("services")
+			selfHealth.watcherFailed("services")
 			time.Sleep(10 * time.Second)
 			continue
 		}
@@ -187,7 +256,7 @@ func (r *EtcdServiceRegistry) updateMeasuredServiceList() {
 			}
 			newMService := NewMeasuredService(&service)
 			r._measuredServices[service.Name] = newMService
-			go r.scheduleCheck(&newMService, time.NewTimer(0))
+			go r.scheduleCheck(&newMService, 0, time.Time{})
 		}
 	}
 
@@ -209,6 +278,8 @@ func (r *EtcdServiceRegistry) watchCategories() {
 		_, err := watcher.Next(context.Background())
 		if err != nil {
 			errorLogger.Printf("Error waiting for change under %v in etcd. %v\n Sleeping 10s...", categoriesKeyPre, err.Error())
+			selfMetrics.etcdErrors.inc("categories")
+			selfHealth.watcherFailed("categories")
 			time.Sleep(10 * time.Second)
 			continue
 		}
@@ -218,10 +289,13 @@ func (r *EtcdServiceRegistry) watchCategories() {
 
 func (r *EtcdServiceRegistry) redefineServiceList() {
 	infoLogger.Print("Reloading service list.")
+	selfMetrics.etcdReloads.inc("services")
 	services := make(map[string]Service)
 	servicesResp, err := r.etcd.Get(context.Background(), servicesKeyPre, &client.GetOptions{Sort: true})
+	selfHealth.etcdRead("services", err)
 	if err != nil {
 		errorLogger.Printf("Failed to get value from %v: %v.", servicesKeyPre, err.Error())
+		selfMetrics.etcdErrors.inc("services")
 		return
 	}
 	if !servicesResp.Node.Dir {
@@ -249,18 +323,51 @@ func (r *EtcdServiceRegistry) redefineServiceList() {
 			categories = append(categories, strings.Split(categoriesResp.Node.Value, ",")...)
 		}
 		ack := r.getServiceAck(serviceNode.Key)
-		services[name] = Service{Name: name, Host: r.vulcandAddr, Path: fmt.Sprintf(pathPre, name, path), Categories: categories, Ack: ack, ServiceKey: serviceNode.Key, Environment: r.environment}
+		settings := r.serviceSettings(serviceNode.Key)
+		services[name] = Service{
+			Name:             name,
+			Host:             r.vulcandAddr,
+			Path:             fmt.Sprintf(pathPre, name, path),
+			Categories:       categories,
+			Ack:              ack,
+			ServiceKey:       serviceNode.Key,
+			Environment:      r.environment,
+			Timeout:          parseServiceTimeout(serviceNode.Key, settings[timeoutSetting]),
+			Headers:          parseServiceHeaders(settings),
+			ExpectedStatuses: parseServiceExpectedStatuses(serviceNode.Key, settings[statusSetting]),
+			HostHeader:       strings.TrimSpace(settings[hostHeaderSetting]),
+			CheckType:        strings.TrimSpace(settings[checkTypeSetting]),
+			Settings:         settings,
+			Severity:         parseServiceSeverity(serviceNode.Key, settings[severitySetting]),
+			BusinessImpact:   strings.TrimSpace(settings[impactSetting]),
+			PanicGuide:       strings.TrimSpace(settings[panicGuideSetting]),
+			Team:             strings.TrimSpace(settings[teamSetting]),
+			SystemCode:       strings.TrimSpace(settings[systemCodeSetting]),
+		}
 	}
 	r.services = services
-	infoLogger.Printf("%v", r.services)
+	// only the names, the settings of the services holding credentials like Authorization headers
+	infoLogger.Printf("Services: %v", serviceNames(r.services))
+}
+
+func serviceNames(services servicesMap) []string {
+	var names []string
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 func (r *EtcdServiceRegistry) redefineCategoryList() {
 	infoLogger.Print("Reloading category list.")
+	selfMetrics.etcdReloads.inc("categories")
 	categories := initCategoryList()
 	categoriesResp, err := r.etcd.Get(context.Background(), categoriesKeyPre, &client.GetOptions{Sort: true})
+	selfHealth.etcdRead("categories", err)
 	if err != nil {
 		errorLogger.Printf("Failed to get value from %v: %v.", categoriesKeyPre, err.Error())
+		selfMetrics.etcdErrors.inc("categories")
 		return
 	}
 	if !categoriesResp.Node.Dir {
@@ -277,8 +384,16 @@ func (r *EtcdServiceRegistry) redefineCategoryList() {
 		period := r.catPeriod(categoryNode.Key)
 		resilient := r.catResilient(categoryNode.Key)
 		enabled := r.catEnabled(categoryNode.Key)
-
-		categories[name] = Category{Name: name, Period: period, IsResilient: resilient, Enabled: enabled}
+		slackChannel := r.catSlackChannel(categoryNode.Key)
+		recipients := r.catEmailRecipients(categoryNode.Key)
+		notificationInterval := r.optionalSeconds(categoryNode.Key, notificationSuffix)
+		escalationPeriod := r.optionalSeconds(categoryNode.Key, escalationSuffix)
+		summaryTemplate := r.catCheckDocTemplate(categoryNode.Key, summaryTplSuffix, "technical summary")
+		panicGuideTemplate := r.catCheckDocTemplate(categoryNode.Key, panicGuideTplSuffix, "panic guide")
+
+		categories[name] = Category{Name: name, Period: period, IsResilient: resilient, Enabled: enabled, SlackChannel: slackChannel,
+			EmailRecipients: recipients, NotificationInterval: notificationInterval, EscalationPeriod: escalationPeriod,
+			TechnicalSummaryTemplate: summaryTemplate, PanicGuideTemplate: panicGuideTemplate}
 	}
 
 	r.Lock()
@@ -334,6 +449,8 @@ func (r *EtcdServiceRegistry) disableCategoryIfSticky(cat string) {
 		_, err = r.etcd.Set(context.Background(), categoriesKeyPre+"/"+cat+enabledSuffix, "false", nil)
 		if err != nil {
 			warnLogger.Printf("Failed to disable %v: %v.\n", categoriesKeyPre+"/"+cat, err.Error())
+		} else if r.notifier != nil {
+			r.notifier.categoryDisabled(cat)
 		}
 		warnLogger.Printf("Setting category enabled %v to false.", cat)
 	}
@@ -353,6 +470,152 @@ func (r *EtcdServiceRegistry) catEnabled(catKey string) (enabled bool) {
 	return
 }
 
+func (r *EtcdServiceRegistry) catSlackChannel(catKey string) string {
+	slackChannelResp, err := r.etcd.Get(context.Background(), catKey+slackChannelSuffix, nil)
+	if err != nil {
+		return ""
+	}
+	return slackChannelResp.Node.Value
+}
+
+// catCheckDocTemplate is the technical summary or panic guide template of the category, nil if not set or invalid.
+func (r *EtcdServiceRegistry) catCheckDocTemplate(catKey string, suffix string, name string) *template.Template {
+	text := r.optionalValue(catKey, suffix)
+	if text == "" {
+		return nil
+	}
+	t, err := parseCheckDocTemplate(name, text)
+	if err != nil {
+		warnLogger.Printf("Ignoring the %v template of %v: %v", name, catKey, err.Error())
+		return nil
+	}
+	return t
+}
+
+func (r *EtcdServiceRegistry) catEmailRecipients(catKey string) []string {
+	recipientsResp, err := r.etcd.Get(context.Background(), catKey+recipientsSuffix, nil)
+	if err != nil {
+		return nil
+	}
+	var recipients []string
+	for _, recipient := range strings.Split(recipientsResp.Node.Value, ",") {
+		if recipient = strings.TrimSpace(recipient); recipient != "" {
+			recipients = append(recipients, recipient)
+		}
+	}
+	return recipients
+}
+
+// optionalSeconds reads an optional duration setting of a category or a service, defaulting to zero.
+func (r *EtcdServiceRegistry) optionalSeconds(key string, suffix string) time.Duration {
+	secondsResp, err := r.etcd.Get(context.Background(), key+suffix, nil)
+	if err != nil {
+		return 0
+	}
+	seconds, err := strconv.Atoi(secondsResp.Node.Value)
+	if err != nil {
+		warnLogger.Printf("Error reading setting '%v' at key %v. Ignoring it.", secondsResp.Node.Value, secondsResp.Node.Key)
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// optionalValue reads an optional setting of a service, defaulting to empty.
+func (r *EtcdServiceRegistry) optionalValue(serviceKey string, suffix string) string {
+	resp, err := r.etcd.Get(context.Background(), serviceKey+suffix, nil)
+	if err != nil || resp.Node.Dir {
+		return ""
+	}
+	return strings.TrimSpace(resp.Node.Value)
+}
+
+// serviceSettings reads every key of the etcd directory of a service, for its check type to pick its settings from.
+func (r *EtcdServiceRegistry) serviceSettings(serviceKey string) map[string]string {
+	serviceResp, err := r.etcd.Get(context.Background(), serviceKey, &client.GetOptions{Recursive: true, Sort: true})
+	if err != nil || !serviceResp.Node.Dir {
+		return nil
+	}
+	settings := make(map[string]string)
+	var collect func(nodes client.Nodes)
+	collect = func(nodes client.Nodes) {
+		for _, node := range nodes {
+			if node.Dir {
+				collect(node.Nodes)
+				continue
+			}
+			settings[strings.TrimPrefix(node.Key, serviceKey+"/")] = node.Value
+		}
+	}
+	collect(serviceResp.Node.Nodes)
+	return settings
+}
+
+// parseServiceSeverity reads the severity setting of a service, zero if it isn't set or invalid.
+func parseServiceSeverity(serviceKey string, value string) uint8 {
+	if value == "" {
+		return 0
+	}
+	severity, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || severity < 1 || severity > 3 {
+		warnLogger.Printf("Error reading severity '%v' at key %v, expecting 1, 2 or 3. Ignoring it.", value, serviceKey+"/"+severitySetting)
+		return 0
+	}
+	return uint8(severity)
+}
+
+// parseServiceTimeout reads the timeout of the healthcheck of a service, zero if it isn't set, invalid or over
+// maxServiceTimeout.
+func parseServiceTimeout(serviceKey string, value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	seconds, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		warnLogger.Printf("Error reading setting '%v' at key %v. Ignoring it.", value, serviceKey+"/"+timeoutSetting)
+		return 0
+	}
+	timeout := time.Duration(seconds) * time.Second
+	if timeout > maxServiceTimeout {
+		warnLogger.Printf("Timeout %v at key %v is over the maximum of %v. Ignoring it.", timeout, serviceKey+"/"+timeoutSetting, maxServiceTimeout)
+		return 0
+	}
+	return timeout
+}
+
+// parseServiceHeaders picks the extra headers of the healthcheck request of a service from its settings, one
+// key per header under the headers directory, e.g. /ft/healthcheck/foo-service-1/headers/Authorization.
+func parseServiceHeaders(settings map[string]string) map[string]string {
+	var headers map[string]string
+	for key, value := range settings {
+		name := strings.TrimPrefix(key, headersSetting)
+		if name == key || name == "" || strings.Contains(name, "/") {
+			continue
+		}
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		headers[name] = value
+	}
+	return headers
+}
+
+// parseServiceExpectedStatuses reads the comma-separated status codes of a successful healthcheck of a service.
+func parseServiceExpectedStatuses(serviceKey string, value string) []int {
+	if value == "" {
+		return nil
+	}
+	var statuses []int
+	for _, status := range strings.Split(value, ",") {
+		code, err := strconv.Atoi(strings.TrimSpace(status))
+		if err != nil {
+			warnLogger.Printf("Error reading expected status '%v' at key %v. Ignoring it.", status, serviceKey+"/"+statusSetting)
+			continue
+		}
+		statuses = append(statuses, code)
+	}
+	return statuses
+}
+
 func (r *EtcdServiceRegistry) getServiceAck(serviceKey string) string {
 
 	ackDetails, err := r.etcd.Get(context.Background(), serviceKey+ackSuffix, nil)
@@ -362,29 +625,43 @@ func (r *EtcdServiceRegistry) getServiceAck(serviceKey string) string {
 	return ackDetails.Node.Value
 }
 
-func (r *EtcdServiceRegistry) scheduleCheck(mService *MeasuredService, timer *time.Timer) {
+// scheduleCheck runs the check of the service once the wait duration since the end of its previous check is
+// over, the previous check being zero for the first one.
+func (r *EtcdServiceRegistry) scheduleCheck(mService *MeasuredService, waitDuration time.Duration, previousCheck time.Time) {
 	// wait
+	due := time.Now().Add(waitDuration)
+	if !previousCheck.IsZero() {
+		due = previousCheck.Add(waitDuration)
+	}
+	timer := time.NewTimer(time.Until(due))
 	select {
 	case <-mService.cachedHealth.terminate:
+		timer.Stop()
 		return
 	case <-timer.C:
 	}
+	selfHealth.checkStarted(mService.service.Name, time.Since(due))
 
 	// run check
+	var measure checkMeasure
 	healthResult := fthealth.RunCheck(mService.service.Name,
 		fmt.Sprintf("Checks the health of %v", mService.service.Name),
 		true,
-		NewServiceHealthCheck(*mService.service, r._checker))
+		measuredServiceCheck(*mService.service, r._checker, r.checkDoc(*mService.service), &measure))
+	checked := time.Now()
+	measure.apply(&healthResult.Checks[0], r._slowThreshold)
+	latency := measure.latency
+	selfMetrics.checksExecuted.inc("")
+	selfMetrics.checkDuration.observe("", latency.Seconds())
 
 	healthResult.Checks[0].Ack = mService.service.Ack
 
-	r.updateCachedAndBufferedHealth(mService, &healthResult)
+	r.updateCachedAndBufferedHealth(mService, &MeasuredHealth{healthResult, latency, measure.slow, measure.health})
 
-	waitDuration := r.findShortestPeriod(*mService.service)
-	go r.scheduleCheck(mService, time.NewTimer(waitDuration))
+	go r.scheduleCheck(mService, r.findShortestPeriod(*mService.service), checked)
 }
 
-func (r *EtcdServiceRegistry) updateCachedAndBufferedHealth(mService *MeasuredService, healthResult *fthealth.HealthResult) {
+func (r *EtcdServiceRegistry) updateCachedAndBufferedHealth(mService *MeasuredService, healthResult *MeasuredHealth) {
 	// write to cache
 	mService.cachedHealth.toWriteToCache <- *healthResult
 
@@ -392,6 +669,11 @@ func (r *EtcdServiceRegistry) updateCachedAndBufferedHealth(mService *MeasuredSe
 	select {
 	case mService.bufferedHealths.buffer <- *healthResult:
 	default:
+		selfMetrics.bufferDrops.inc("")
+	}
+
+	if r.notifier != nil {
+		r.notifier.observeService(*mService.service, *healthResult)
 	}
 }
 
@@ -2,7 +2,6 @@ package main
 
 import (
 	"errors"
-	"os"
 	"testing"
 	"time"
 
@@ -78,7 +77,6 @@ func TestRedefineCategoryList(t *testing.T) {
 }
 
 func TestWatchCategories(t *testing.T) {
-	initLogs(os.Stdout, os.Stdout, os.Stderr)
 
 	fooCategory := client.Node{Key: "/ft/healthcheck-categories/foo", Dir: true, Nodes: client.Nodes{}}
 	categoryNodes := client.Nodes{&fooCategory}
@@ -100,3 +98,40 @@ func TestWatchCategories(t *testing.T) {
 	_, categoryPresent = actual["foo"]
 	assert.True(t, categoryPresent, "foo category should be present")
 }
+
+func TestParseServiceSeverity(t *testing.T) {
+
+	assert.Equal(t, uint8(0), parseServiceSeverity("/ft/healthcheck/foo", ""))
+	assert.Equal(t, uint8(1), parseServiceSeverity("/ft/healthcheck/foo", " 1 "))
+	assert.Equal(t, uint8(3), parseServiceSeverity("/ft/healthcheck/foo", "3"))
+	assert.Equal(t, uint8(0), parseServiceSeverity("/ft/healthcheck/foo", "4"))
+	assert.Equal(t, uint8(0), parseServiceSeverity("/ft/healthcheck/foo", "critical"))
+}
+
+func TestParseServiceTimeout(t *testing.T) {
+
+	assert.Equal(t, time.Duration(0), parseServiceTimeout("/ft/healthcheck/foo", ""))
+	assert.Equal(t, 3*time.Second, parseServiceTimeout("/ft/healthcheck/foo", " 3 "))
+	assert.Equal(t, maxServiceTimeout, parseServiceTimeout("/ft/healthcheck/foo", "10"))
+	assert.Equal(t, time.Duration(0), parseServiceTimeout("/ft/healthcheck/foo", "30"), "the transport would cut it short")
+	assert.Equal(t, time.Duration(0), parseServiceTimeout("/ft/healthcheck/foo", "soon"))
+}
+
+func TestParseServiceHeaders(t *testing.T) {
+	headers := parseServiceHeaders(map[string]string{
+		"path":                  "/__health",
+		"headers/Authorization": "Basic Zm9vOmJhcg==",
+		"headers/X-Request-Id":  "aggregate-healthcheck",
+		"headers/nested/key":    "ignored",
+	})
+
+	assert.Equal(t, map[string]string{"Authorization": "Basic Zm9vOmJhcg==", "X-Request-Id": "aggregate-healthcheck"}, headers)
+	assert.Nil(t, parseServiceHeaders(map[string]string{"path": "/__health"}))
+}
+
+func TestParseServiceExpectedStatuses(t *testing.T) {
+
+	assert.Nil(t, parseServiceExpectedStatuses("/ft/healthcheck/foo", ""))
+	assert.Equal(t, []int{200, 204}, parseServiceExpectedStatuses("/ft/healthcheck/foo", "200, 204"))
+	assert.Equal(t, []int{200}, parseServiceExpectedStatuses("/ft/healthcheck/foo", "200,ok"))
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	slackUsername  = "aggregate-healthcheck"
+	slackIconEmoji = ":heartbeat:"
+	slackGreen     = "good"
+	slackRed       = "danger"
+	slackOrange    = "warning"
+	slackBlue      = "#439FE0"
+)
+
+type slackMessage struct {
+	Channel     string            `json:"channel,omitempty"`
+	Username    string            `json:"username,omitempty"`
+	IconEmoji   string            `json:"icon_emoji,omitempty"`
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments,omitempty"`
+}
+
+type slackAttachment struct {
+	Fallback  string       `json:"fallback"`
+	Color     string       `json:"color"`
+	Title     string       `json:"title"`
+	TitleLink string       `json:"title_link,omitempty"`
+	Text      string       `json:"text,omitempty"`
+	Fields    []slackField `json:"fields,omitempty"`
+	Ts        int64        `json:"ts"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+// SlackSink posts notifications to a Slack-compatible incoming webhook. Notifications are routed to the
+// channels configured for their categories, or to the webhook's default channel if none is configured.
+// When a notification is retried, it is only posted again to the channels it failed to reach.
+type SlackSink struct {
+	url      string
+	client   *http.Client
+	registry ServiceRegistry
+	// the last message sent and the channels it reached, notifications being sent one at a time
+	lastMessage string
+	deliveredTo map[string]bool
+}
+
+func NewSlackSink(url string, client *http.Client, registry ServiceRegistry) *SlackSink {
+	return &SlackSink{url: url, client: client, registry: registry, deliveredTo: make(map[string]bool)}
+}
+
+func (s *SlackSink) Name() string {
+	return "slack"
+}
+
+func (s *SlackSink) Send(notification Notification) error {
+	message := formatSlackMessage(notification)
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		return errors.New("Error encoding slack message: " + err.Error())
+	}
+	if string(encoded) != s.lastMessage {
+		s.lastMessage = string(encoded)
+		s.deliveredTo = make(map[string]bool)
+	}
+
+	var failed []string
+	for _, channel := range s.channelsFor(notification) {
+		if s.deliveredTo[channel] {
+			continue
+		}
+		message.Channel = channel
+		body, err := json.Marshal(message)
+		if err != nil {
+			return errors.New("Error encoding slack message: " + err.Error())
+		}
+		if err := postJSON(s.client, s.url, body); err != nil {
+			failed = append(failed, err.Error())
+			continue
+		}
+		s.deliveredTo[channel] = true
+	}
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+func (s *SlackSink) channelsFor(notification Notification) []string {
+	categories := s.registry.categories()
+	channelSet := make(map[string]bool)
+	for _, name := range notification.Categories {
+		if category, found := categories[name]; found && category.SlackChannel != "" {
+			channelSet[category.SlackChannel] = true
+		}
+	}
+	if len(channelSet) == 0 {
+		// an empty channel posts to the default channel of the webhook
+		return []string{""}
+	}
+	var channels []string
+	for channel := range channelSet {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+func formatSlackMessage(n Notification) slackMessage {
+	summary := n.summary()
+	attachment := slackAttachment{
+		Fallback:  summary,
+		Color:     slackColor(n),
+		Title:     summary,
+		TitleLink: n.PanicGuide,
+		Text:      n.Output,
+		Ts:        n.Time.Unix(),
+	}
+	attachment.Fields = append(attachment.Fields, slackField{"Environment", n.Environment, true})
+	if n.Service != "" {
+		attachment.Fields = append(attachment.Fields, slackField{"Service", n.Service, true})
+	}
+	if n.Category != "" {
+		attachment.Fields = append(attachment.Fields, slackField{"Category", n.Category, true})
+	}
+	if n.Team != "" {
+		attachment.Fields = append(attachment.Fields, slackField{"Team", n.Team, true})
+	}
+	if len(n.FailingChecks) > 0 {
+		attachment.Fields = append(attachment.Fields, slackField{"Failing checks", n.failingChecksSummary(), false})
+	}
+	if n.Severity != 0 {
+		attachment.Fields = append(attachment.Fields, slackField{"Severity", severityName(n.Severity), true})
+	}
+	if n.Ack != "" {
+		attachment.Fields = append(attachment.Fields, slackField{"Acked", n.Ack, false})
+	}
+	if n.ClusterAck != "" && n.Event != clusterAcked {
+		attachment.Fields = append(attachment.Fields, slackField{"Cluster acked", n.ClusterAck, false})
+	}
+	if n.PanicGuide != "" {
+		attachment.Fields = append(attachment.Fields, slackField{"Panic guide", "<" + n.PanicGuide + "|Panic guide>", true})
+	}
+
+	return slackMessage{
+		Username:    slackUsername,
+		IconEmoji:   slackIconEmoji,
+		Text:        summary,
+		Attachments: []slackAttachment{attachment},
+	}
+}
+
+func slackColor(n Notification) string {
+	switch {
+	case n.Ack != "" || n.Event == clusterAcked:
+		return slackBlue
+	case n.Event == categoryDisabled:
+		return slackRed
+	case n.Event == clusterAckRemoved:
+		return slackOrange
+	case n.Ok:
+		return slackGreen
+	case n.Severity == 1:
+		return slackRed
+	}
+	return slackOrange
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlackSinkRoutesToCategoryChannels(t *testing.T) {
+	var messages []slackMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message slackMessage
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&message))
+		messages = append(messages, message)
+	}))
+	defer server.Close()
+
+	registry := new(MockRegistry)
+	registry.On("categories").Return(map[string]Category{
+		"default": {Name: "default"},
+		"read":    {Name: "read", SlackChannel: "#read-alerts"},
+		"publish": {Name: "publish", SlackChannel: "#publish-alerts"},
+	})
+
+	sink := NewSlackSink(server.URL, http.DefaultClient, registry)
+	err := sink.Send(Notification{
+		Event:       serviceStateChanged,
+		Environment: "prod-uk",
+		Service:     "foo-service-1",
+		Categories:  []string{"default", "read", "publish"},
+		Severity:    1,
+		Output:      "1 healthchecks failing (db)",
+		PanicGuide:  "https://example.com/panic",
+		Time:        time.Now(),
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, messages, 2)
+	var channels []string
+	for _, message := range messages {
+		channels = append(channels, message.Channel)
+	}
+	sort.Strings(channels)
+	assert.Equal(t, []string{"#publish-alerts", "#read-alerts"}, channels)
+}
+
+func TestSlackSinkUsesDefaultChannel(t *testing.T) {
+	var messages []slackMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message slackMessage
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&message))
+		messages = append(messages, message)
+	}))
+	defer server.Close()
+
+	registry := new(MockRegistry)
+	registry.On("categories").Return(map[string]Category{"default": {Name: "default"}})
+
+	sink := NewSlackSink(server.URL, http.DefaultClient, registry)
+	err := sink.Send(Notification{Event: clusterAcked, Environment: "prod-uk", Ack: "release in progress"})
+
+	assert.NoError(t, err)
+	assert.Len(t, messages, 1)
+	assert.Equal(t, "", messages[0].Channel)
+}
+
+func TestSlackSinkRetriesOnlyFailedChannels(t *testing.T) {
+	failing := true
+	posted := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message slackMessage
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&message))
+		posted[message.Channel]++
+		if failing && message.Channel == "#publish-alerts" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	registry := new(MockRegistry)
+	registry.On("categories").Return(map[string]Category{
+		"read":    {Name: "read", SlackChannel: "#read-alerts"},
+		"publish": {Name: "publish", SlackChannel: "#publish-alerts"},
+	})
+
+	sink := NewSlackSink(server.URL, http.DefaultClient, registry)
+	notification := Notification{Event: serviceStateChanged, Service: "foo-service-1", Categories: []string{"read", "publish"}, Time: time.Now()}
+	assert.Error(t, sink.Send(notification))
+
+	failing = false
+	assert.NoError(t, sink.Send(notification))
+	assert.Equal(t, map[string]int{"#read-alerts": 1, "#publish-alerts": 2}, posted)
+
+	notification.Ok = true
+	assert.NoError(t, sink.Send(notification))
+	assert.Equal(t, map[string]int{"#read-alerts": 2, "#publish-alerts": 3}, posted, "a new notification goes to every channel")
+}
+
+func TestFormatSlackMessage(t *testing.T) {
+	message := formatSlackMessage(Notification{
+		Event:       serviceStateChanged,
+		Environment: "prod-uk",
+		Service:     "foo-service-1",
+		Severity:    1,
+		Output:      "1 healthchecks failing (db)",
+		PanicGuide:  "https://example.com/panic",
+		Ack:         "on it",
+	})
+
+	assert.Equal(t, "foo-service-1 is unhealthy in prod-uk", message.Text)
+	assert.Len(t, message.Attachments, 1)
+	attachment := message.Attachments[0]
+	assert.Equal(t, slackBlue, attachment.Color, "acked services are blue")
+	assert.Equal(t, "https://example.com/panic", attachment.TitleLink)
+	assert.Equal(t, "1 healthchecks failing (db)", attachment.Text)
+	assert.Contains(t, attachment.Fields, slackField{"Severity", "critical", true})
+	assert.Contains(t, attachment.Fields, slackField{"Acked", "on it", false})
+	assert.Contains(t, attachment.Fields, slackField{"Environment", "prod-uk", true})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// StatsdSink emits the health of every service check as a gauge, 1 if it passed and 0 otherwise, and its
+// latency as a timer, to a StatsD agent over UDP. With tags enabled, the service, its group, its categories
+// and the environment are DogStatsD tags instead of being part of the metric names.
+//
+// StatsD stamps the metrics as they arrive, so the metrics that can't be sent are dropped rather than kept.
+type StatsdSink struct {
+	addr        string
+	prefix      string
+	environment string
+	tagged      bool
+	conn        net.Conn
+}
+
+func NewStatsdSink(addr string, prefix string, environment string, tagged bool) *StatsdSink {
+	s := &StatsdSink{addr: addr, prefix: prefix, environment: environment, tagged: tagged}
+	connectSink(s.Name(), s)
+	return s
+}
+
+func (s *StatsdSink) Name() string {
+	return "statsd " + s.addr
+}
+
+func (s *StatsdSink) Send(snapshot HealthSnapshot) error {
+	var lines []string
+	for _, result := range snapshot.Results {
+		lines = append(lines, s.lines(result.Service, result.Health)...)
+	}
+	err := s.write(lines)
+	if err != nil {
+		selfMetrics.sinkFailures.inc(s.Name())
+		reconnectSink(s.Name(), s)
+	}
+	return err
+}
+
+// lines are the gauge and the timer of a single check of the service, e.g. with the default prefix
+// coco.health.prod.services.foo-service-1.up:0|g and coco.health.prod.services.foo-service-1.latency:250|ms
+// or, tagged, coco.health.service.up:0|g|#environment:prod,service:foo-service-1,service_group:foo-service,category:default
+func (s *StatsdSink) lines(service Service, result MeasuredHealth) []string {
+	up := formatValue(boolToFloat(result.Checks[0].Ok))
+	latency := formatValue(float64(result.Latency.Nanoseconds()) / 1e6)
+	if !s.tagged {
+		name := fmt.Sprintf("%v.%v.services.%v", s.prefix, sanitiseStatsdName(s.environment), sanitiseStatsdName(service.Name))
+		return []string{
+			fmt.Sprintf("%v.up:%v|g", name, up),
+			fmt.Sprintf("%v.latency:%v|ms", name, latency),
+		}
+	}
+
+	group, _ := splitServiceInstance(service.Name)
+	tags := []string{"environment:" + s.environment, "service:" + service.Name, "service_group:" + group}
+	categories := service.Categories
+	if len(categories) == 0 {
+		categories = []string{defaultCategoryName}
+	}
+	for _, category := range categories {
+		tags = append(tags, "category:"+category)
+	}
+	for i, tag := range tags {
+		tags[i] = statsdTagReplacer.Replace(tag)
+	}
+	suffix := "|#" + strings.Join(tags, ",")
+	return []string{
+		fmt.Sprintf("%v.service.up:%v|g%v", s.prefix, up, suffix),
+		fmt.Sprintf("%v.service.latency:%v|ms%v", s.prefix, latency, suffix),
+	}
+}
+
+// write sends the metrics to the StatsD agent, packed into as few datagrams as possible.
+func (s *StatsdSink) write(lines []string) error {
+	if s.conn == nil {
+		return errors.New("Can't send results, no StatsD connection.")
+	}
+	for _, datagram := range packDatagrams(lines, "\n") {
+		if _, err := s.conn.Write(datagram); err != nil {
+			return fmt.Errorf("Error sending results to StatsD: [%v]", err.Error())
+		}
+	}
+	return nil
+}
+
+func (s *StatsdSink) connect() error {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	conn, err := net.Dial("udp", s.addr)
+	if err != nil {
+		return fmt.Errorf("Error while creating UDP connection [%v]", err)
+	}
+	s.conn = conn
+	return nil
+}
+
+func (s *StatsdSink) isConnected() bool {
+	return s.conn != nil
+}
+
+func (s *StatsdSink) address() string {
+	return s.addr
+}
+
+// sanitiseStatsdName replaces the characters separating or breaking StatsD metric name nodes.
+func sanitiseStatsdName(node string) string {
+	return statsdNameReplacer.Replace(node)
+}
+
+var statsdNameReplacer = strings.NewReplacer(".", "-", " ", "_", ":", "_", "|", "_", "@", "_")
+
+var statsdTagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", " ", "_")
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	fthealth "github.com/Financial-Times/go-fthealth/v1a"
+	"github.com/stretchr/testify/assert"
+)
+
+var statsdResult = MeasuredHealth{
+	HealthResult: fthealth.HealthResult{Checks: []fthealth.CheckResult{{Name: "foo-service-1", Ok: false, LastUpdated: time.Unix(1500000000, 0)}}},
+	Latency:      250 * time.Millisecond,
+}
+
+func TestStatsdLines(t *testing.T) {
+	sink := &StatsdSink{prefix: defaultGraphitePrefix, environment: "prod"}
+
+	lines := sink.lines(Service{Name: "foo.service-1", Categories: []string{"read"}}, statsdResult)
+
+	assert.Equal(t, []string{
+		"coco.health.prod.services.foo-service-1.up:0|g",
+		"coco.health.prod.services.foo-service-1.latency:250|ms",
+	}, lines)
+}
+
+func TestStatsdTaggedLines(t *testing.T) {
+	sink := &StatsdSink{prefix: defaultGraphitePrefix, environment: "prod", tagged: true}
+
+	lines := sink.lines(Service{Name: "foo-service-1", Categories: []string{"read", "publish,write"}}, statsdResult)
+
+	tags := "|#environment:prod,service:foo-service-1,service_group:foo-service,category:read,category:publish_write"
+	assert.Equal(t, []string{
+		"coco.health.service.up:0|g" + tags,
+		"coco.health.service.latency:250|ms" + tags,
+	}, lines)
+}
+
+func TestStatsdSinkSendsDatagrams(t *testing.T) {
+	agent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer agent.Close()
+
+	sink := NewStatsdSink(agent.LocalAddr().String(), defaultGraphitePrefix, "test", false)
+	err = sink.Send(HealthSnapshot{Results: []ServiceResult{{Service{Name: "foo-service-1"}, statsdResult}}})
+	assert.NoError(t, err)
+
+	agent.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, maxUDPPayload)
+	n, _, err := agent.ReadFrom(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"coco.health.test.services.foo-service-1.up:0|g",
+		"coco.health.test.services.foo-service-1.latency:250|ms",
+	}, strings.Split(string(buf[:n]), "\n"))
+}
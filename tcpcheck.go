@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+const defaultTCPConnectTimeout = 5 * time.Second
+
+// TCPConnectChecker checks that services, like databases or queues, accept TCP connections, connecting
+// through the same dialer as the HTTP checks, e.g. the SOCKS proxy.
+type TCPConnectChecker struct {
+	dialer proxy.Dialer
+}
+
+// tcpConnectConfig are the settings of tcp-connect checks: address (host:port) and timeout_seconds.
+type tcpConnectConfig struct {
+	address string
+	timeout time.Duration
+}
+
+func NewTCPConnectChecker(dialer proxy.Dialer) *TCPConnectChecker {
+	return &TCPConnectChecker{dialer}
+}
+
+func parseTCPConnectConfig(service Service) (tcpConnectConfig, error) {
+	address, err := service.setting("address")
+	if err != nil {
+		return tcpConnectConfig{}, err
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return tcpConnectConfig{}, fmt.Errorf("Invalid setting %v/address '%v', expecting host:port", service.ServiceKey, address)
+	}
+	timeout, err := service.settingSeconds("timeout_seconds", defaultTCPConnectTimeout)
+	if err != nil {
+		return tcpConnectConfig{}, err
+	}
+	return tcpConnectConfig{address: address, timeout: timeout}, nil
+}
+
+func (c *TCPConnectChecker) Check(service Service) (string, error) {
+	config, err := parseTCPConnectConfig(service)
+	if err != nil {
+		return "", err
+	}
+	conn, err := dialWithin(c.dialer, config.address, config.timeout)
+	if err != nil {
+		return "", fmt.Errorf("Error connecting to %v: %v", config.address, err.Error())
+	}
+	conn.Close()
+	return fmt.Sprintf("Connected to %v", config.address), nil
+}
+
+// dialWithin connects to the address within the timeout, as proxy dialers don't take one.
+func dialWithin(dialer proxy.Dialer, address string, timeout time.Duration) (net.Conn, error) {
+	type dialed struct {
+		conn net.Conn
+		err  error
+	}
+	done := make(chan dialed, 1)
+	go func() {
+		conn, err := dialer.Dial("tcp", address)
+		done <- dialed{conn, err}
+	}()
+	select {
+	case d := <-done:
+		return d.conn, d.err
+	case <-time.After(timeout):
+		go func() {
+			// close the connection if it is established too late
+			if d := <-done; d.err == nil {
+				d.conn.Close()
+			}
+		}()
+		return nil, fmt.Errorf("timed out after %v", timeout)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/proxy"
+)
+
+func TestTCPConnectCheck(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := listener.Addr().String()
+	service := Service{Name: "db", ServiceKey: "/ft/healthcheck/db", CheckType: tcpConnectCheckType, Settings: map[string]string{"address": addr}}
+
+	output, err := NewTCPConnectChecker(proxy.Direct).Check(service)
+	assert.NoError(t, err)
+	assert.Equal(t, "Connected to "+addr, output)
+
+	listener.Close()
+	_, err = NewTCPConnectChecker(proxy.Direct).Check(service)
+	assert.Error(t, err)
+}
+
+// blockingDialer never connects, giving up once the context of the test is done.
+type blockingDialer struct {
+	ctx context.Context
+}
+
+func (d blockingDialer) Dial(network, addr string) (net.Conn, error) {
+	<-d.ctx.Done()
+	return nil, d.ctx.Err()
+}
+
+func TestTCPConnectCheckUsesDialer(t *testing.T) {
+	service := Service{Name: "db", ServiceKey: "/ft/healthcheck/db", CheckType: tcpConnectCheckType, Settings: map[string]string{"address": "db:5432", "timeout_seconds": "1"}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := NewTCPConnectChecker(blockingDialer{ctx}).Check(service)
+
+	assert.EqualError(t, err, "Error connecting to db:5432: timed out after 1s")
+}
+
+func TestTCPConnectCheckInvalidAddress(t *testing.T) {
+	service := Service{Name: "db", ServiceKey: "/ft/healthcheck/db", CheckType: tcpConnectCheckType, Settings: map[string]string{"address": "db"}}
+
+	_, err := NewTCPConnectChecker(proxy.Direct).Check(service)
+
+	assert.EqualError(t, err, "Invalid setting /ft/healthcheck/db/address 'db', expecting host:port")
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+type WebhookConfig struct {
+	URL string `json:"url"`
+	NotificationFilter
+}
+
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookSink(url string, client *http.Client) *WebhookSink {
+	return &WebhookSink{url, client}
+}
+
+func (s *WebhookSink) Name() string {
+	return "webhook " + s.url
+}
+
+func (s *WebhookSink) Send(notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return errors.New("Error encoding notification: " + err.Error())
+	}
+	return postJSON(s.client, s.url, body)
+}
+
+func postJSON(client *http.Client, url string, body []byte) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return errors.New("Error constructing notification request: " + err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.New("Error sending notification: " + err.Error())
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Notification endpoint returned non-2xx status (%v)", resp.Status)
+	}
+	return nil
+}
+
+// parseWebhookConfigs reads the webhook sinks from their JSON definition,
+// e.g. [{"url": "https://example.com/hook", "categories": ["read"], "minSeverity": 1}]
+func parseWebhookConfigs(definition string) ([]WebhookConfig, error) {
+	var configs []WebhookConfig
+	if definition == "" {
+		return configs, nil
+	}
+	if err := json.Unmarshal([]byte(definition), &configs); err != nil {
+		return nil, errors.New("Error parsing webhook definitions: " + err.Error())
+	}
+	for _, config := range configs {
+		if config.URL == "" {
+			return nil, errors.New("Webhook definition without url")
+		}
+	}
+	return configs, nil
+}